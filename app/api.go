@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/sirupsen/logrus"
+)
+
+type SupportedCurrenciesResponse struct {
+	SupportedCurrencies []string  `json:"supported_currencies"`
+	Count               int       `json:"count"`
+	Total               int       `json:"total"`
+	Offset              int       `json:"offset"`
+	Date                string    `json:"date,omitempty"`
+	UpdatedAt           time.Time `json:"updated_at"`
+}
+
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// apiHandler serves the read-only HTTP API exposed through API Gateway.
+func apiHandler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	logger := logrus.WithFields(logrus.Fields{
+		"route":      request.RouteKey,
+		"path":       request.RawPath,
+		"request_id": request.RequestContext.RequestID,
+	})
+	logger.Info("API request received")
+
+	if err := ensureAWSClients(ctx); err != nil {
+		logger.WithError(err).Error("Failed to initialize AWS clients")
+		return errorResponse(http.StatusServiceUnavailable, "service temporarily unavailable"), nil
+	}
+	refreshConfig(ctx)
+
+	var response events.APIGatewayV2HTTPResponse
+	switch request.RouteKey {
+	case "GET /currencies":
+		response = handleGetSupportedCurrencies(ctx, logger, request.QueryStringParameters)
+	case "GET /status":
+		response = handleGetStatus(ctx, logger)
+	default:
+		response = errorResponse(http.StatusNotFound, "route not found")
+	}
+
+	return compressResponse(logger, request.Headers["accept-encoding"], response), nil
+}
+
+// compressResponse gzips bodies larger than API_GZIP_MIN_BYTES when the client accepts gzip.
+// API Gateway passes binary bodies through base64, so the compressed body is encoded as such.
+func compressResponse(logger *logrus.Entry, acceptEncoding string, response events.APIGatewayV2HTTPResponse) events.APIGatewayV2HTTPResponse {
+	if apiGzipMinBytes <= 0 || len(response.Body) < apiGzipMinBytes || !acceptsGzip(acceptEncoding) {
+		return response
+	}
+
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write([]byte(response.Body)); err != nil {
+		logger.WithError(err).Warn("Failed to gzip API response, sending it uncompressed")
+		return response
+	}
+	if err := writer.Close(); err != nil {
+		logger.WithError(err).Warn("Failed to gzip API response, sending it uncompressed")
+		return response
+	}
+
+	logger.WithFields(logrus.Fields{
+		"uncompressed_bytes": len(response.Body),
+		"compressed_bytes":   buf.Len(),
+	}).Debug("API response compressed")
+
+	response.Body = base64.StdEncoding.EncodeToString(buf.Bytes())
+	response.IsBase64Encoded = true
+	response.Headers["Content-Encoding"] = "gzip"
+	response.Headers["Vary"] = "Accept-Encoding"
+	return response
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip, honoring an explicit q=0.
+func acceptsGzip(acceptEncoding string) bool {
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+
+		quality := strings.ReplaceAll(strings.TrimSpace(params), " ", "")
+		if value, ok := strings.CutPrefix(quality, "q="); ok {
+			if q, err := strconv.ParseFloat(value, 64); err == nil && q == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// handleGetSupportedCurrencies returns the stored supported currencies configuration.
+// Optional query parameters:
+//   - date:   only include currencies that have exchange rates stored for this date (YYYY-MM-DD)
+//   - limit:  maximum number of currencies to return
+//   - offset: number of currencies to skip before applying the limit
+func handleGetSupportedCurrencies(ctx context.Context, logger *logrus.Entry, params map[string]string) events.APIGatewayV2HTTPResponse {
+	date := params["date"]
+	if date != "" {
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			return errorResponse(http.StatusBadRequest, "date must be in YYYY-MM-DD format")
+		}
+	}
+
+	limit, err := parseNonNegativeParam(params, "limit")
+	if err != nil {
+		return errorResponse(http.StatusBadRequest, err.Error())
+	}
+	offset, err := parseNonNegativeParam(params, "offset")
+	if err != nil {
+		return errorResponse(http.StatusBadRequest, err.Error())
+	}
+
+	record, err := getSupportedCurrencies(ctx)
+	if err != nil {
+		logger.WithError(err).Error("Failed to read supported currencies")
+		return errorResponse(http.StatusInternalServerError, "failed to read supported currencies")
+	}
+	if record == nil {
+		return errorResponse(http.StatusNotFound, "supported currencies configuration not found")
+	}
+
+	currencies := record.SupportedCurrencies
+	if date != "" {
+		existing, err := batchCheckExistingExchangeRates(ctx, currencies, date)
+		if err != nil {
+			logger.WithError(err).Error("Failed to check exchange rates availability")
+			return errorResponse(http.StatusInternalServerError, "failed to check exchange rates availability")
+		}
+		available := make([]string, 0, len(currencies))
+		for _, currency := range currencies {
+			if existing[currency] != nil {
+				available = append(available, currency)
+			}
+		}
+		currencies = available
+	}
+
+	total := len(currencies)
+	if offset > total {
+		offset = total
+	}
+	currencies = currencies[offset:]
+	if limit > 0 && limit < len(currencies) {
+		currencies = currencies[:limit]
+	}
+
+	logger.WithFields(logrus.Fields{
+		"date":     date,
+		"limit":    limit,
+		"offset":   offset,
+		"total":    total,
+		"returned": len(currencies),
+	}).Debug("Supported currencies listed")
+
+	return jsonResponse(http.StatusOK, SupportedCurrenciesResponse{
+		SupportedCurrencies: currencies,
+		Count:               len(currencies),
+		Total:               total,
+		Offset:              offset,
+		Date:                date,
+		UpdatedAt:           record.UpdatedAt,
+	})
+}
+
+func getSupportedCurrencies(ctx context.Context) (*SupportedCurrenciesRecord, error) {
+	keyItem, err := attributevalue.MarshalMap(map[string]interface{}{
+		"Key":     prefixedKey(supportedCurrenciesKey),
+		"SortKey": "-",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling supported currencies key: %w", err)
+	}
+
+	result, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(tableName),
+		Key:       keyItem,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading supported currencies: %w", err)
+	}
+
+	if result.Item == nil {
+		return nil, nil
+	}
+
+	var record SupportedCurrenciesRecord
+	if err := attributevalue.UnmarshalMap(result.Item, &record); err != nil {
+		return nil, fmt.Errorf("error unmarshaling supported currencies record: %w", err)
+	}
+	record.Key = unprefixedKey(record.Key)
+
+	return &record, nil
+}
+
+func parseNonNegativeParam(params map[string]string, name string) (int, error) {
+	valueStr := params[name]
+	if valueStr == "" {
+		return 0, nil
+	}
+
+	value, err := strconv.Atoi(valueStr)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer", name)
+	}
+	return value, nil
+}
+
+func jsonResponse(statusCode int, body interface{}) events.APIGatewayV2HTTPResponse {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to marshal API response")
+		return events.APIGatewayV2HTTPResponse{
+			StatusCode: http.StatusInternalServerError,
+			Body:       `{"error":"failed to marshal response"}`,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+		}
+	}
+
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: statusCode,
+		Body:       string(payload),
+		Headers:    map[string]string{"Content-Type": "application/json"},
+	}
+}
+
+func errorResponse(statusCode int, message string) events.APIGatewayV2HTTPResponse {
+	return jsonResponse(statusCode, ErrorResponse{Error: message})
+}
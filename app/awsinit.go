@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/sirupsen/logrus"
+)
+
+// AWS clients are set up lazily at the start of an invocation rather than in setup(), so a
+// transient failure loading the SDK config fails that invocation instead of crash-looping the
+// cold start. Once set up they are reused for the lifetime of the execution environment. With
+// CONFIG_S3_URI set, setup creates them to read the config object, which must load at cold start.
+var (
+	awsClientsMu    sync.Mutex
+	awsClientsReady bool
+)
+
+// ensureAWSClients loads the SDK config and creates the AWS clients, retrying up to
+// INIT_MAX_ATTEMPTS times with exponential backoff from INIT_BACKOFF_MS. After a successful
+// setup it returns immediately; after a failed one the next invocation tries again.
+func ensureAWSClients(ctx context.Context) error {
+	awsClientsMu.Lock()
+	defer awsClientsMu.Unlock()
+
+	if awsClientsReady {
+		return nil
+	}
+
+	delay := time.Duration(initBackoffMs) * time.Millisecond
+	var err error
+	for attempt := 1; attempt <= initMaxAttempts; attempt++ {
+		var cfg aws.Config
+		cfg, err = config.LoadDefaultConfig(ctx)
+		if err == nil {
+			dynamoClient = dynamodb.NewFromConfig(cfg)
+			s3Client = s3.NewFromConfig(cfg)
+			sqsClient = sqs.NewFromConfig(cfg)
+			cloudwatchClient = cloudwatch.NewFromConfig(cfg)
+			awsClientsReady = true
+			logrus.WithField("attempt", attempt).Info("AWS clients initialized")
+			return nil
+		}
+
+		logger := logrus.WithError(err).WithFields(logrus.Fields{
+			"attempt":      attempt,
+			"max_attempts": initMaxAttempts,
+		})
+		if attempt == initMaxAttempts {
+			logger.Error("Failed to load SDK config, giving up for this invocation")
+			break
+		}
+		logger.WithField("backoff_ms", delay.Milliseconds()).Warn("Failed to load SDK config, retrying")
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		delay *= 2
+	}
+
+	return fmt.Errorf("unable to load SDK config after %d attempts: %w", initMaxAttempts, err)
+}
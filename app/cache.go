@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	providerCacheNone     = "none"
+	providerCacheMemory   = "memory"
+	providerCacheDynamoDB = "dynamodb"
+)
+
+// Providers publish once or twice a day and announce when the next update is due. A response is
+// cached under (provider, base) together with its publish timestamp and reused until that next
+// update, so later currencies and invocations in the same publish cycle skip the provider call.
+// Responses without a next update time are never cached.
+
+type providerCacheEntry struct {
+	rates        *ExchangeRateResponse
+	nextUpdateAt time.Time
+}
+
+// ProviderCacheRecord persists a cached provider response for the dynamodb cache mode.
+type ProviderCacheRecord struct {
+	Key              string             `dynamodbav:"Key"`
+	SortKey          string             `dynamodbav:"SortKey"`
+	BaseCode         string             `dynamodbav:"BaseCode"`
+	ConversionRates  map[string]float64 `dynamodbav:"ConversionRates"`
+	BidRates         map[string]float64 `dynamodbav:"BidRates,omitempty"`
+	AskRates         map[string]float64 `dynamodbav:"AskRates,omitempty"`
+	PublishedAt      time.Time          `dynamodbav:"PublishedAt"`
+	NextUpdateAt     time.Time          `dynamodbav:"NextUpdateAt"`
+	ExpiresAt        int64              `dynamodbav:"ExpiresAt"`
+	SchemaVersion    int                `dynamodbav:"SchemaVersion"`
+	WrittenByVersion string             `dynamodbav:"WrittenByVersion,omitempty"`
+}
+
+var (
+	providerCacheMu      sync.Mutex
+	providerCacheEntries = make(map[string]providerCacheEntry)
+)
+
+func providerCacheKey(provider string) string {
+	return prefixedKey("ProviderCache#" + provider)
+}
+
+// cloneExchangeRates copies the rate maps, which are modified by later transformations.
+func cloneExchangeRates(rates *ExchangeRateResponse) *ExchangeRateResponse {
+	clone := *rates
+	clone.ConversionRates = maps.Clone(rates.ConversionRates)
+	clone.BidRates = maps.Clone(rates.BidRates)
+	clone.AskRates = maps.Clone(rates.AskRates)
+	return &clone
+}
+
+// lookupProviderCache returns a copy of the cached response for the base when it is still from
+// the provider's current publish cycle, checking memory first and then DynamoDB.
+func lookupProviderCache(ctx context.Context, logger *logrus.Entry, provider, baseCurrency string) *ExchangeRateResponse {
+	if providerCacheMode == providerCacheNone {
+		return nil
+	}
+
+	now := time.Now()
+	memoryKey := provider + "/" + baseCurrency
+
+	providerCacheMu.Lock()
+	entry, ok := providerCacheEntries[memoryKey]
+	providerCacheMu.Unlock()
+
+	source := providerCacheMemory
+	if !ok || !now.Before(entry.nextUpdateAt) {
+		if providerCacheMode != providerCacheDynamoDB {
+			return nil
+		}
+
+		var err error
+		entry, ok, err = loadProviderCacheRecord(ctx, provider, baseCurrency)
+		if err != nil {
+			logger.WithError(err).Warn("Failed to read provider cache, fetching from the provider")
+			return nil
+		}
+		if !ok || !now.Before(entry.nextUpdateAt) {
+			return nil
+		}
+
+		providerCacheMu.Lock()
+		providerCacheEntries[memoryKey] = entry
+		providerCacheMu.Unlock()
+		source = providerCacheDynamoDB
+	}
+
+	logger.WithFields(logrus.Fields{
+		"cache":          source,
+		"published_at":   entry.rates.RateTimestamp.Format(time.RFC3339),
+		"next_update_at": entry.nextUpdateAt.Format(time.RFC3339),
+	}).Info("Provider cache hit, reusing rates from the current publish cycle")
+
+	// No request was made, so the original fetch's metadata does not describe this one
+	rates := cloneExchangeRates(entry.rates)
+	rates.FetchMeta = nil
+	return rates
+}
+
+// storeProviderCache caches a fresh response until the provider's announced next update.
+// Failing to persist it only costs a provider call later, so errors are logged, not returned.
+func storeProviderCache(ctx context.Context, logger *logrus.Entry, provider, baseCurrency string, rates *ExchangeRateResponse) {
+	if providerCacheMode == providerCacheNone || rates.TimeNextUpdateUnix <= 0 {
+		return
+	}
+
+	nextUpdateAt := time.Unix(rates.TimeNextUpdateUnix, 0).UTC()
+	if !time.Now().Before(nextUpdateAt) {
+		return
+	}
+	entry := providerCacheEntry{rates: cloneExchangeRates(rates), nextUpdateAt: nextUpdateAt}
+
+	providerCacheMu.Lock()
+	providerCacheEntries[provider+"/"+baseCurrency] = entry
+	providerCacheMu.Unlock()
+
+	if providerCacheMode == providerCacheDynamoDB {
+		if err := storeProviderCacheRecord(ctx, provider, baseCurrency, entry); err != nil {
+			logger.WithError(err).Warn("Failed to persist provider cache entry")
+			return
+		}
+	}
+
+	logger.WithFields(logrus.Fields{
+		"cache":          providerCacheMode,
+		"published_at":   rates.RateTimestamp.Format(time.RFC3339),
+		"next_update_at": nextUpdateAt.Format(time.RFC3339),
+	}).Debug("Provider response cached")
+}
+
+func loadProviderCacheRecord(ctx context.Context, provider, baseCurrency string) (providerCacheEntry, bool, error) {
+	keyItem, err := attributevalue.MarshalMap(map[string]interface{}{
+		"Key":     providerCacheKey(provider),
+		"SortKey": baseCurrency,
+	})
+	if err != nil {
+		return providerCacheEntry{}, false, fmt.Errorf("error marshaling provider cache key for %s: %w", baseCurrency, err)
+	}
+
+	result, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(tableName),
+		Key:       keyItem,
+	})
+	if err != nil {
+		return providerCacheEntry{}, false, fmt.Errorf("error reading provider cache for %s: %w", baseCurrency, err)
+	}
+	if result.Item == nil {
+		return providerCacheEntry{}, false, nil
+	}
+
+	var record ProviderCacheRecord
+	if err := attributevalue.UnmarshalMap(result.Item, &record); err != nil {
+		return providerCacheEntry{}, false, fmt.Errorf("error unmarshaling provider cache record for %s: %w", baseCurrency, err)
+	}
+
+	return providerCacheEntry{
+		rates: &ExchangeRateResponse{
+			Result:             "success",
+			BaseCode:           record.BaseCode,
+			ConversionRates:    record.ConversionRates,
+			BidRates:           record.BidRates,
+			AskRates:           record.AskRates,
+			TimeNextUpdateUnix: record.NextUpdateAt.Unix(),
+			RateTimestamp:      record.PublishedAt,
+		},
+		nextUpdateAt: record.NextUpdateAt,
+	}, true, nil
+}
+
+func storeProviderCacheRecord(ctx context.Context, provider, baseCurrency string, entry providerCacheEntry) error {
+	record := ProviderCacheRecord{
+		Key:              providerCacheKey(provider),
+		SortKey:          baseCurrency,
+		BaseCode:         entry.rates.BaseCode,
+		ConversionRates:  entry.rates.ConversionRates,
+		BidRates:         entry.rates.BidRates,
+		AskRates:         entry.rates.AskRates,
+		PublishedAt:      entry.rates.RateTimestamp,
+		NextUpdateAt:     entry.nextUpdateAt,
+		ExpiresAt:        entry.nextUpdateAt.Unix(),
+		SchemaVersion:    providerCacheSchemaVersion,
+		WrittenByVersion: buildVersion,
+	}
+
+	item, err := attributevalue.MarshalMap(record)
+	if err != nil {
+		return fmt.Errorf("error marshaling provider cache record for %s: %w", baseCurrency, err)
+	}
+
+	_, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(tableName),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("error storing provider cache record for %s: %w", baseCurrency, err)
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/sirupsen/logrus"
+)
+
+// The config object is a JSON object of setting names, the same names as the environment
+// variables, to values that override the environment:
+//
+//	{"SUPPORTED_CURRENCIES": ["EUR", "GBP"], "ROUND_DECIMALS": 6, "CURRENCY_CODE_REMAP": {"CNH": "CNY"}}
+//
+// Strings, numbers and booleans are used as they are, arrays are joined with "|" like list
+// variables, and objects are passed on as JSON. The merged values then go through the same
+// parsing and validation as plain environment variables.
+
+var configNamePattern = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+
+// Settings that control loading the config object itself, and the runtime's own variables,
+// cannot be overridden by it
+var configEnvOnly = map[string]bool{
+	"CONFIG_S3_URI":          true,
+	"CONFIG_REFRESH_SECONDS": true,
+	"INIT_MAX_ATTEMPTS":      true,
+	"INIT_BACKOFF_MS":        true,
+}
+
+var (
+	configETag     string
+	configLoadedAt time.Time
+
+	// Values of the config object currently applied, restored when a refreshed one is invalid
+	configValues map[string]string
+
+	// Environment values replaced by the config object, restored when a refreshed object no
+	// longer sets them; nil means the variable was not set
+	configOriginalEnv = make(map[string]*string)
+)
+
+// parseS3URI splits an s3://bucket/key URI.
+func parseS3URI(uri string) (string, string, error) {
+	rest, ok := strings.CutPrefix(uri, "s3://")
+	bucket, key, found := strings.Cut(rest, "/")
+	if !ok || !found || bucket == "" || key == "" {
+		return "", "", fmt.Errorf("config URI %q must have the form s3://bucket/key", uri)
+	}
+	return bucket, key, nil
+}
+
+// fetchConfigObject downloads the config object, returning its body and ETag.
+func fetchConfigObject(ctx context.Context) ([]byte, string, error) {
+	bucket, key, err := parseS3URI(configS3URI)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := ensureAWSClients(ctx); err != nil {
+		return nil, "", err
+	}
+
+	result, err := s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading config object: %w", err)
+	}
+	defer result.Body.Close()
+
+	body, err := io.ReadAll(result.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading config object body: %w", err)
+	}
+	return body, aws.ToString(result.ETag), nil
+}
+
+// parseConfigObject converts the config object into environment variable values.
+func parseConfigObject(body []byte) (map[string]string, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, fmt.Errorf("config object must be a JSON object: %w", err)
+	}
+
+	values := make(map[string]string, len(raw))
+	for name, value := range raw {
+		if !configNamePattern.MatchString(name) || configEnvOnly[name] || strings.HasPrefix(name, "AWS_") {
+			return nil, fmt.Errorf("config object cannot set %q", name)
+		}
+
+		trimmed := bytes.TrimSpace(value)
+		switch {
+		case len(trimmed) > 0 && trimmed[0] == '"':
+			var text string
+			if err := json.Unmarshal(trimmed, &text); err != nil {
+				return nil, fmt.Errorf("invalid value for %s: %w", name, err)
+			}
+			values[name] = text
+		case len(trimmed) > 0 && trimmed[0] == '[':
+			var items []interface{}
+			if err := json.Unmarshal(trimmed, &items); err != nil {
+				return nil, fmt.Errorf("invalid value for %s: %w", name, err)
+			}
+			parts := make([]string, 0, len(items))
+			for _, item := range items {
+				parts = append(parts, fmt.Sprint(item))
+			}
+			values[name] = strings.Join(parts, "|")
+		case len(trimmed) > 0 && trimmed[0] == '{':
+			values[name] = string(trimmed)
+		case string(trimmed) == "true" || string(trimmed) == "false":
+			values[name] = string(trimmed)
+		default:
+			number, err := strconv.ParseFloat(string(trimmed), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value for %s: %s", name, trimmed)
+			}
+			values[name] = strconv.FormatFloat(number, 'f', -1, 64)
+		}
+	}
+	return values, nil
+}
+
+// applyConfigValues sets the environment to the config values, restoring variables that a
+// previous config object set but this one does not.
+func applyConfigValues(values map[string]string) {
+	for name, original := range configOriginalEnv {
+		if _, ok := values[name]; ok {
+			continue
+		}
+		if original == nil {
+			os.Unsetenv(name)
+		} else {
+			os.Setenv(name, *original)
+		}
+		delete(configOriginalEnv, name)
+	}
+
+	for name, value := range values {
+		if _, saved := configOriginalEnv[name]; !saved {
+			if original, ok := os.LookupEnv(name); ok {
+				configOriginalEnv[name] = &original
+			} else {
+				configOriginalEnv[name] = nil
+			}
+		}
+		os.Setenv(name, value)
+	}
+}
+
+// loadConfigObject reads the config object at cold start and applies its values over the
+// environment. loadSettings validates them afterwards, so setup stops the function when the
+// object cannot be read or holds an invalid value.
+func loadConfigObject(ctx context.Context) error {
+	body, etag, err := fetchConfigObject(ctx)
+	if err != nil {
+		return err
+	}
+	values, err := parseConfigObject(body)
+	if err != nil {
+		return err
+	}
+
+	applyConfigValues(values)
+	configValues = values
+	configETag = etag
+	configLoadedAt = time.Now()
+
+	logrus.WithFields(logrus.Fields{
+		"config_uri": configS3URI,
+		"etag":       etag,
+		"settings":   len(values),
+	}).Info("Configuration loaded from S3")
+	return nil
+}
+
+// refreshConfig reloads the config object once CONFIG_REFRESH_SECONDS have passed since it was
+// last read, applying it when its ETag changed. Unlike the cold start load, a refreshed object
+// that cannot be read or is invalid does not stop the function: it is logged and the last good
+// settings stay in effect.
+func refreshConfig(ctx context.Context) {
+	if configS3URI == "" || configRefreshSeconds <= 0 ||
+		time.Since(configLoadedAt) < time.Duration(configRefreshSeconds)*time.Second {
+		return
+	}
+
+	logger := logrus.WithField("config_uri", configS3URI)
+	body, etag, err := fetchConfigObject(ctx)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to refresh configuration, keeping the current settings")
+		return
+	}
+	configLoadedAt = time.Now()
+	if etag == configETag {
+		logger.WithField("etag", etag).Debug("Configuration unchanged")
+		return
+	}
+
+	values, err := parseConfigObject(body)
+	if err != nil {
+		logger.WithError(err).WithField("etag", etag).Warn("Refreshed configuration is invalid, keeping the current settings")
+		return
+	}
+
+	previous := configValues
+	applyConfigValues(values)
+	if err := loadSettings(); err != nil {
+		logger.WithError(err).WithField("etag", etag).Warn("Refreshed configuration is invalid, keeping the current settings")
+
+		// loadSettings stops at the first invalid value, so settings read before it are
+		// restored by loading the last good values again
+		applyConfigValues(previous)
+		if err := loadSettings(); err != nil {
+			logger.WithError(err).Error("Failed to restore the previous settings")
+		}
+		return
+	}
+	configValues = values
+	configETag = etag
+
+	logger.WithFields(logrus.Fields{
+		"etag":     etag,
+		"settings": len(values),
+	}).Info("Configuration refreshed from S3")
+}
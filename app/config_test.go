@@ -0,0 +1,123 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestParseConfigObject(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"empty object", `{}`, map[string]string{}, false},
+		{"string", `{"LOG_LEVEL": "debug"}`, map[string]string{"LOG_LEVEL": "debug"}, false},
+		{"integer", `{"ROUND_DECIMALS": 6}`, map[string]string{"ROUND_DECIMALS": "6"}, false},
+		{"float", `{"SUSPECT_DROP_RATIO": 0.25}`, map[string]string{"SUSPECT_DROP_RATIO": "0.25"}, false},
+		{"large integer keeps its digits", `{"TTL_INTERVAL_DAYS": 1e6}`, map[string]string{"TTL_INTERVAL_DAYS": "1000000"}, false},
+		{"boolean", `{"FILTER_PEGGED_RATES": true}`, map[string]string{"FILTER_PEGGED_RATES": "true"}, false},
+		{"array joined as a list", `{"SUPPORTED_CURRENCIES": ["EUR", "GBP"]}`, map[string]string{"SUPPORTED_CURRENCIES": "EUR|GBP"}, false},
+		{"object passed on as JSON", `{"CURRENCY_CODE_REMAP": {"CNH": "CNY"}}`, map[string]string{"CURRENCY_CODE_REMAP": `{"CNH": "CNY"}`}, false},
+
+		{"not an object", `["EUR"]`, nil, true},
+		{"malformed", `{"LOG_LEVEL": `, nil, true},
+		{"lowercase name", `{"log_level": "debug"}`, nil, true},
+		{"env only setting", `{"CONFIG_REFRESH_SECONDS": 60}`, nil, true},
+		{"AWS variable", `{"AWS_REGION": "eu-west-1"}`, nil, true},
+		{"null value", `{"LOG_LEVEL": null}`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseConfigObject([]byte(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseConfigObject() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseConfigObject() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyConfigValuesRestoresEnvironment(t *testing.T) {
+	t.Setenv("LOG_LEVEL", "info")
+	t.Setenv("ROUND_DECIMALS", "")
+	os.Unsetenv("ROUND_DECIMALS")
+	t.Cleanup(func() { applyConfigValues(nil) })
+
+	applyConfigValues(map[string]string{"LOG_LEVEL": "debug", "ROUND_DECIMALS": "4"})
+	if got := os.Getenv("LOG_LEVEL"); got != "debug" {
+		t.Errorf("LOG_LEVEL = %q after apply, want debug", got)
+	}
+	if got := os.Getenv("ROUND_DECIMALS"); got != "4" {
+		t.Errorf("ROUND_DECIMALS = %q after apply, want 4", got)
+	}
+
+	// A refreshed object without the settings restores what the environment had
+	applyConfigValues(map[string]string{})
+	if got := os.Getenv("LOG_LEVEL"); got != "info" {
+		t.Errorf("LOG_LEVEL = %q after restore, want info", got)
+	}
+	if _, ok := os.LookupEnv("ROUND_DECIMALS"); ok {
+		t.Error("ROUND_DECIMALS is set after restore, want unset")
+	}
+}
+
+func TestParseS3URI(t *testing.T) {
+	tests := []struct {
+		uri        string
+		wantBucket string
+		wantKey    string
+		wantErr    bool
+	}{
+		{"s3://config-bucket/cooker/config.json", "config-bucket", "cooker/config.json", false},
+		{"s3://config-bucket/", "", "", true},
+		{"s3://config-bucket", "", "", true},
+		{"https://config-bucket/config.json", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.uri, func(t *testing.T) {
+			bucket, key, err := parseS3URI(tt.uri)
+			if (err != nil) != tt.wantErr || bucket != tt.wantBucket || key != tt.wantKey {
+				t.Errorf("parseS3URI(%q) = %q, %q, %v, want %q, %q, wantErr %v", tt.uri, bucket, key, err, tt.wantBucket, tt.wantKey, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadSettingsReturnsInvalidValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr bool
+	}{
+		{"defaults", nil, false},
+		{"integer", map[string]string{"TTL_INTERVAL_DAYS": "a month"}, true},
+		{"boolean", map[string]string{"CAPTURE_SPREADS": "sometimes"}, true},
+		{"out of range", map[string]string{"ROUND_DECIMALS": "20"}, true},
+		{"unknown policy", map[string]string{"REPORT_FORMAT": "pdf"}, true},
+		{"invalid JSON setting", map[string]string{"CURRENCY_CODE_REMAP": `{"CNH": 1}`}, true},
+		{"unknown time zone", map[string]string{"TIMEZONE": "Mars/Olympus_Mons"}, true},
+		{"pivot not supported", map[string]string{"SUPPORTED_CURRENCIES": "EUR|GBP", "PAIR_PIVOT": "USD"}, true},
+		{"table missing", map[string]string{"EXCHANGE_RATE_DB_NAME": ""}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LOG_LEVEL", "error")
+			t.Setenv("EXCHANGE_RATE_DB_NAME", "exchange-rates")
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			if err := loadSettings(); (err != nil) != tt.wantErr {
+				t.Errorf("loadSettings() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
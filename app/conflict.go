@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/sirupsen/logrus"
+)
+
+// When several regions run the cooker against one table, each stamps its records with
+// WRITE_SOURCE. A write conflicts when another source already stored a non-degraded record for
+// the same currency and date; WRITE_CONFLICT_POLICY decides whether that is ignored, logged or
+// rejected with a conditional write. Degraded records may always be replaced by fresh rates.
+const (
+	writeConflictOff    = "off"
+	writeConflictLog    = "log"
+	writeConflictReject = "reject"
+)
+
+// WriteConflictError is returned when WRITE_CONFLICT_POLICY is reject and another source
+// already stored the record.
+type WriteConflictError struct {
+	Source string
+}
+
+func (e *WriteConflictError) Error() string {
+	return fmt.Sprintf("record already written by source %q", e.Source)
+}
+
+// conflictsWithRecord reports whether existing was written by another source and must not be
+// replaced silently.
+func conflictsWithRecord(existing *ExchangeRateRecord) bool {
+	return existing != nil && !existing.Degraded && existing.Source != "" && existing.Source != writeSource
+}
+
+// logWriteConflict reads the stored record before a write and logs when another source wrote
+// it. A failed read is logged and does not block the write.
+func logWriteConflict(ctx context.Context, logger *logrus.Entry, baseCurrency, date string) {
+	existing, err := checkExistingExchangeRates(ctx, baseCurrency, date)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to read existing record for write conflict detection")
+		return
+	}
+	if conflictsWithRecord(existing) {
+		logger.WithFields(logrus.Fields{
+			"conflicting_source": existing.Source,
+			"source":             writeSource,
+			"existing_updated":   existing.UpdatedAt.Format(time.RFC3339),
+		}).Warn("Overwriting exchange rates written by another source")
+	}
+}
+
+// putExchangeRatesExclusive stores item unless another source already wrote a non-degraded
+// record under its key, in which case it returns a WriteConflictError naming that source.
+func putExchangeRatesExclusive(ctx context.Context, logger *logrus.Entry, baseCurrency, date string, item map[string]types.AttributeValue) error {
+	values, err := attributevalue.MarshalMap(map[string]interface{}{
+		":source":   writeSource,
+		":degraded": true,
+	})
+	if err != nil {
+		return fmt.Errorf("error marshaling write condition for %s: %w", baseCurrency, err)
+	}
+
+	_, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:                 aws.String(tableName),
+		Item:                      item,
+		ConditionExpression:       aws.String("attribute_not_exists(#key) OR attribute_not_exists(#source) OR #source = :source OR Degraded = :degraded"),
+		ExpressionAttributeNames:  map[string]string{"#key": "Key", "#source": "Source"},
+		ExpressionAttributeValues: values,
+	})
+	if err == nil {
+		return nil
+	}
+
+	var conditionErr *types.ConditionalCheckFailedException
+	if !errors.As(err, &conditionErr) {
+		return fmt.Errorf("error storing rates for %s: %w", baseCurrency, err)
+	}
+
+	conflict := &WriteConflictError{Source: "unknown"}
+	if existing, readErr := checkExistingExchangeRates(ctx, baseCurrency, date); readErr == nil && existing != nil {
+		conflict.Source = existing.Source
+	}
+	logger.WithFields(logrus.Fields{
+		"conflicting_source": conflict.Source,
+		"source":             writeSource,
+	}).Warn("Rejected write, exchange rates were already written by another source")
+	return conflict
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/sirupsen/logrus"
+)
+
+const runCursorKey = "RunCursor"
+
+// RunCursorRecord remembers where the provider call budget stopped the last run, so the next
+// run starts there instead of at the top of the list again. ListHash identifies the currency
+// list the cursor points into; a cursor for another list is discarded.
+type RunCursorRecord struct {
+	Key              string    `dynamodbav:"Key"`
+	SortKey          string    `dynamodbav:"SortKey"`
+	NextCurrency     string    `dynamodbav:"NextCurrency"`
+	NextIndex        int       `dynamodbav:"NextIndex"`
+	ListHash         string    `dynamodbav:"ListHash"`
+	UpdatedAt        time.Time `dynamodbav:"UpdatedAt"`
+	SchemaVersion    int       `dynamodbav:"SchemaVersion"`
+	WrittenByVersion string    `dynamodbav:"WrittenByVersion,omitempty"`
+}
+
+// currencyListHash fingerprints the configured currency list, order included.
+func currencyListHash(currencies []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(currencies, "|")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// rotateByRunCursor returns the currencies starting at the stored cursor, wrapping around, and
+// the index it started at. Without a usable cursor the list is returned unchanged. Reading the
+// cursor is best effort: on failure the run simply starts at the top.
+func rotateByRunCursor(ctx context.Context, currencies []string) ([]string, int) {
+	if len(currencies) == 0 {
+		return currencies, 0
+	}
+
+	record, err := getRunCursor(ctx)
+	if err != nil {
+		logrus.WithError(err).Warn("Failed to read run cursor, starting at the first currency")
+		return currencies, 0
+	}
+	if record == nil {
+		return currencies, 0
+	}
+
+	listHash := currencyListHash(currencies)
+	if record.ListHash != listHash || record.NextIndex < 0 || record.NextIndex >= len(currencies) ||
+		currencies[record.NextIndex] != record.NextCurrency {
+		logrus.WithFields(logrus.Fields{
+			"cursor_currency": record.NextCurrency,
+			"cursor_index":    record.NextIndex,
+		}).Info("Supported currencies changed since the cursor was stored, starting at the first currency")
+		return currencies, 0
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"cursor_currency": record.NextCurrency,
+		"cursor_index":    record.NextIndex,
+	}).Info("Continuing from the run cursor")
+	rotated := make([]string, 0, len(currencies))
+	rotated = append(rotated, currencies[record.NextIndex:]...)
+	return append(rotated, currencies[:record.NextIndex]...), record.NextIndex
+}
+
+// nextCursorIndex returns the position in currencies of the first currency, in processing
+// order, that the provider call budget skipped, or 0 when the run got through all of them.
+// It returns -1, no cursor, when currencies is empty or the skipped currency is not in it.
+func nextCursorIndex(currencies, processed []string, stats *RunStats) int {
+	if len(currencies) == 0 {
+		return -1
+	}
+	outcomes := stats.Outcomes()
+	for _, currency := range processed {
+		if outcomes[currency] == outcomeSkippedBudget {
+			return slices.Index(currencies, currency)
+		}
+	}
+	return 0
+}
+
+// storeRunCursor saves where the next run should start. An index outside currencies is no
+// cursor and nothing is stored.
+func storeRunCursor(ctx context.Context, currencies []string, nextIndex int) error {
+	if nextIndex < 0 || nextIndex >= len(currencies) {
+		logrus.WithField("next_index", nextIndex).Debug("No run cursor to store")
+		return nil
+	}
+
+	record := RunCursorRecord{
+		Key:              prefixedKey(runCursorKey),
+		SortKey:          "-",
+		NextCurrency:     currencies[nextIndex],
+		NextIndex:        nextIndex,
+		ListHash:         currencyListHash(currencies),
+		UpdatedAt:        time.Now(),
+		SchemaVersion:    runCursorSchemaVersion,
+		WrittenByVersion: buildVersion,
+	}
+
+	item, err := attributevalue.MarshalMap(record)
+	if err != nil {
+		return fmt.Errorf("error marshaling run cursor: %w", err)
+	}
+
+	_, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(tableName),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("error storing run cursor: %w", err)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"next_currency": record.NextCurrency,
+		"next_index":    nextIndex,
+	}).Debug("Run cursor stored")
+	return nil
+}
+
+func getRunCursor(ctx context.Context) (*RunCursorRecord, error) {
+	keyItem, err := attributevalue.MarshalMap(map[string]interface{}{
+		"Key":     prefixedKey(runCursorKey),
+		"SortKey": "-",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling run cursor key: %w", err)
+	}
+
+	result, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(tableName),
+		Key:       keyItem,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading run cursor: %w", err)
+	}
+
+	if result.Item == nil {
+		return nil, nil
+	}
+
+	var record RunCursorRecord
+	if err := attributevalue.UnmarshalMap(result.Item, &record); err != nil {
+		return nil, fmt.Errorf("error unmarshaling run cursor record: %w", err)
+	}
+	record.Key = unprefixedKey(record.Key)
+
+	return &record, nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNextCursorIndex(t *testing.T) {
+	currencies := []string{"EUR", "GBP", "CHF", "JPY"}
+
+	tests := []struct {
+		name       string
+		currencies []string
+		processed  []string
+		outcomes   map[string]string
+		want       int
+	}{
+		{"all processed", currencies, []string{"CHF", "JPY", "EUR", "GBP"},
+			map[string]string{"CHF": outcomeSuccess, "JPY": outcomeSuccess, "EUR": outcomeSuccess, "GBP": outcomeSuccess}, 0},
+		{"first skipped in processing order", currencies, []string{"CHF", "JPY", "EUR", "GBP"},
+			map[string]string{"CHF": outcomeSuccess, "JPY": outcomeSkippedBudget, "EUR": outcomeSkippedBudget}, 3},
+		{"skipped currency not in list", currencies, []string{"EUR", "USD"},
+			map[string]string{"EUR": outcomeSuccess, "USD": outcomeSkippedBudget}, -1},
+		{"empty list", nil, nil, nil, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats := NewRunStats()
+			for currency, outcome := range tt.outcomes {
+				stats.Record(context.Background(), currency, outcome)
+			}
+			if got := nextCursorIndex(tt.currencies, tt.processed, stats); got != tt.want {
+				t.Errorf("nextCursorIndex() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
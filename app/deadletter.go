@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	currencyFailuresKey = "CurrencyFailures"
+	deadLetterKey       = "DeadLetter"
+)
+
+type CurrencyFailuresRecord struct {
+	Key                 string    `dynamodbav:"Key"`
+	SortKey             string    `dynamodbav:"SortKey"`
+	ConsecutiveFailures int       `dynamodbav:"ConsecutiveFailures"`
+	LastError           string    `dynamodbav:"LastError"`
+	UpdatedAt           time.Time `dynamodbav:"UpdatedAt"`
+	SchemaVersion       int       `dynamodbav:"SchemaVersion"`
+}
+
+type DeadLetterRecord struct {
+	Key                 string    `dynamodbav:"Key"`
+	SortKey             string    `dynamodbav:"SortKey"`
+	ConsecutiveFailures int       `dynamodbav:"ConsecutiveFailures"`
+	LastError           string    `dynamodbav:"LastError"`
+	DeadLetteredAt      time.Time `dynamodbav:"DeadLetteredAt"`
+	SchemaVersion       int       `dynamodbav:"SchemaVersion"`
+}
+
+// deadLetterEnabled reports whether consecutive failure tracking is configured.
+func deadLetterEnabled() bool {
+	return deadLetterThreshold > 0
+}
+
+// isDeadLettered checks whether a dead-letter record exists for the currency.
+func isDeadLettered(ctx context.Context, baseCurrency string) (bool, error) {
+	keyItem, err := attributevalue.MarshalMap(map[string]interface{}{
+		"Key":     prefixedKey(deadLetterKey),
+		"SortKey": baseCurrency,
+	})
+	if err != nil {
+		return false, fmt.Errorf("error marshaling dead-letter key for %s: %w", baseCurrency, err)
+	}
+
+	result, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(tableName),
+		Key:       keyItem,
+	})
+	if err != nil {
+		return false, fmt.Errorf("error checking dead-letter record for %s: %w", baseCurrency, err)
+	}
+
+	return result.Item != nil, nil
+}
+
+// recordCurrencyFailure increments the consecutive failure counter for the currency and
+// moves it to the dead-letter record once the configured threshold is reached.
+func recordCurrencyFailure(ctx context.Context, logger *logrus.Entry, baseCurrency string, failure error) {
+	keyItem, err := attributevalue.MarshalMap(map[string]interface{}{
+		"Key":     prefixedKey(currencyFailuresKey),
+		"SortKey": baseCurrency,
+	})
+	if err != nil {
+		logger.WithError(err).Error("Failed to marshal currency failures key")
+		return
+	}
+
+	values, err := attributevalue.MarshalMap(map[string]interface{}{
+		":one":           1,
+		":lastError":     redactSecrets(failure.Error()),
+		":updatedAt":     time.Now(),
+		":schemaVersion": currencyFailuresSchemaVersion,
+	})
+	if err != nil {
+		logger.WithError(err).Error("Failed to marshal currency failures update")
+		return
+	}
+
+	result, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(tableName),
+		Key:                       keyItem,
+		UpdateExpression:          aws.String("ADD ConsecutiveFailures :one SET LastError = :lastError, UpdatedAt = :updatedAt, SchemaVersion = :schemaVersion"),
+		ExpressionAttributeValues: values,
+		ReturnValues:              types.ReturnValueUpdatedNew,
+	})
+	if err != nil {
+		logger.WithError(err).Error("Failed to increment consecutive failures")
+		return
+	}
+
+	var updated CurrencyFailuresRecord
+	if err := attributevalue.UnmarshalMap(result.Attributes, &updated); err != nil {
+		logger.WithError(err).Error("Failed to unmarshal consecutive failures")
+		return
+	}
+
+	logger.WithFields(logrus.Fields{
+		"consecutive_failures": updated.ConsecutiveFailures,
+		"dead_letter_at":       deadLetterThreshold,
+	}).Warn("Incremented consecutive failures for currency")
+
+	// Only dead-letter once, when the streak first reaches the threshold
+	if updated.ConsecutiveFailures != deadLetterThreshold {
+		return
+	}
+
+	if err := storeDeadLetter(ctx, logger, baseCurrency, updated.ConsecutiveFailures, failure); err != nil {
+		logger.WithError(err).Error("Failed to store dead-letter record")
+		return
+	}
+
+	// The metric field is matched by a CloudWatch log metric filter so operators can alarm on it
+	logger.WithFields(logrus.Fields{
+		"metric":               "CurrencyDeadLettered",
+		"consecutive_failures": updated.ConsecutiveFailures,
+		"skip_dead_lettered":   deadLetterSkip,
+	}).Error("Currency moved to dead-letter after repeated failures")
+}
+
+// resetCurrencyFailures clears the failure streak and any dead-letter record after a successful run.
+func resetCurrencyFailures(ctx context.Context, logger *logrus.Entry, baseCurrency string) {
+	for _, key := range []string{currencyFailuresKey, deadLetterKey} {
+		keyItem, err := attributevalue.MarshalMap(map[string]interface{}{
+			"Key":     prefixedKey(key),
+			"SortKey": baseCurrency,
+		})
+		if err != nil {
+			logger.WithError(err).Error("Failed to marshal currency failures key")
+			return
+		}
+
+		result, err := dynamoClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+			TableName:    aws.String(tableName),
+			Key:          keyItem,
+			ReturnValues: types.ReturnValueAllOld,
+		})
+		if err != nil {
+			logger.WithError(err).WithField("record", key).Error("Failed to reset currency failure record")
+			continue
+		}
+
+		if result.Attributes != nil {
+			logger.WithField("record", key).Info("Currency recovered, failure record cleared")
+		}
+	}
+}
+
+func storeDeadLetter(ctx context.Context, logger *logrus.Entry, baseCurrency string, consecutiveFailures int, failure error) error {
+	record := DeadLetterRecord{
+		Key:                 prefixedKey(deadLetterKey),
+		SortKey:             baseCurrency,
+		ConsecutiveFailures: consecutiveFailures,
+		LastError:           redactSecrets(failure.Error()),
+		DeadLetteredAt:      time.Now(),
+		SchemaVersion:       deadLetterSchemaVersion,
+	}
+
+	item, err := attributevalue.MarshalMap(record)
+	if err != nil {
+		return fmt.Errorf("error marshaling dead-letter record for %s: %w", baseCurrency, err)
+	}
+
+	_, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(tableName),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("error storing dead-letter record for %s: %w", baseCurrency, err)
+	}
+
+	logger.WithFields(logrus.Fields{
+		"consecutive_failures": consecutiveFailures,
+		"table":                tableName,
+	}).Debug("Successfully stored dead-letter record to DynamoDB")
+	return nil
+}
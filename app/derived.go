@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/sirupsen/logrus"
+)
+
+// DerivedCurrency is a currency computed locally from fetched rates, defined as a basket: one
+// unit of Code is worth Weights[c] units of each component currency c. A fixed peg is a basket
+// with a single component.
+type DerivedCurrency struct {
+	Code    string
+	Weights map[string]float64
+	Formula string
+}
+
+// loadDerivedCurrencies parses DERIVED_CURRENCIES, a JSON object of derived codes to their
+// component weights, e.g. {"XBK": {"EUR": 0.5, "USD": 0.6}}.
+func loadDerivedCurrencies(derivedJSON string) ([]DerivedCurrency, error) {
+	if derivedJSON == "" {
+		return nil, nil
+	}
+
+	var raw map[string]map[string]float64
+	if err := json.Unmarshal([]byte(derivedJSON), &raw); err != nil {
+		return nil, fmt.Errorf("DERIVED_CURRENCIES must be a JSON object of currency codes to component weights: %w", err)
+	}
+
+	derived := make([]DerivedCurrency, 0, len(raw))
+	for code, weights := range raw {
+		if !isCurrencyCode(code) || len(weights) == 0 {
+			return nil, fmt.Errorf("DERIVED_CURRENCIES entry %q must be a currency code with at least one component", code)
+		}
+		for component, weight := range weights {
+			if !isCurrencyCode(component) || component == code || weight <= 0 || math.IsInf(weight, 0) {
+				return nil, fmt.Errorf("DERIVED_CURRENCIES component %q of %s must be another currency code with a positive weight, got %v", component, code, weight)
+			}
+		}
+		derived = append(derived, DerivedCurrency{Code: code, Weights: weights, Formula: derivedFormula(weights)})
+	}
+
+	sort.Slice(derived, func(i, j int) bool { return derived[i].Code < derived[j].Code })
+	return derived, nil
+}
+
+// derivedFormula renders weights as a readable linear combination, e.g. "0.5*EUR + 0.6*USD".
+func derivedFormula(weights map[string]float64) string {
+	components := make([]string, 0, len(weights))
+	for component := range weights {
+		components = append(components, component)
+	}
+	sort.Strings(components)
+
+	terms := make([]string, 0, len(components))
+	for _, component := range components {
+		terms = append(terms, strconv.FormatFloat(weights[component], 'f', -1, 64)+"*"+component)
+	}
+	return strings.Join(terms, " + ")
+}
+
+// storeDerivedCurrencies computes and stores every DERIVED_CURRENCIES record for date from the
+// PAIR_PIVOT record stored for the same day, so no provider calls are made. A currency whose
+// components are missing from the pivot record is skipped; the skipped codes are returned.
+func storeDerivedCurrencies(ctx context.Context, date string) ([]string, error) {
+	pivot, err := resolveExchangeRates(ctx, pairPivot, date)
+	if err != nil {
+		return nil, err
+	}
+	if pivot == nil {
+		return nil, fmt.Errorf("no %s exchange rates stored for %s to derive currencies from", pairPivot, date)
+	}
+
+	var stored, skipped []string
+	for _, currency := range derivedCurrencies {
+		logger := currencyLogger(currency.Code).WithField("formula", currency.Formula)
+
+		rates, missing := deriveRates(currency, pivot.ExchangeRates)
+		if len(missing) > 0 {
+			logger.WithField("missing_inputs", missing).Error("Derived currency inputs are missing from the pivot rates")
+			skipped = append(skipped, currency.Code)
+			continue
+		}
+
+		if err := storeDerivedRates(ctx, currency, date, rates, pivot); err != nil {
+			return nil, err
+		}
+		logger.WithField("rates_count", len(rates)).Debug("Stored derived currency")
+		stored = append(stored, currency.Code)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"derived": stored,
+		"skipped": skipped,
+		"pivot":   pairPivot,
+	}).Info("Derived currencies stored")
+	return skipped, nil
+}
+
+// deriveRates computes the rates from a derived currency to every target in pivotRates. One
+// unit is worth sum(weight * pivot[target] / pivot[component]) units of the target. It returns
+// the components without a usable pivot rate instead when there are any.
+func deriveRates(currency DerivedCurrency, pivotRates map[string]float64) (map[string]float64, []string) {
+	var missing []string
+	inPivot := 0.0
+	for component, weight := range currency.Weights {
+		rate, ok := pivotRates[component]
+		if component == pairPivot {
+			// The pivot's self rate is absent with SELF_RATE_MODE exclude
+			rate, ok = 1, true
+		}
+		if !ok || rate <= 0 {
+			missing = append(missing, component)
+			continue
+		}
+		inPivot += weight / rate
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, missing
+	}
+
+	rates := make(map[string]float64, len(pivotRates)+2)
+	for target, rate := range pivotRates {
+		rates[target] = inPivot * rate
+	}
+	rates[pairPivot] = inPivot
+	if selfRateMode == selfRateInclude {
+		rates[currency.Code] = 1
+	}
+	if roundDecimals >= 0 {
+		for target, rate := range rates {
+			rates[target] = roundRate(target, rate)
+		}
+	}
+	return rates, nil
+}
+
+func storeDerivedRates(ctx context.Context, currency DerivedCurrency, date string, rates map[string]float64, pivot *ExchangeRateRecord) error {
+	record := ExchangeRateRecord{
+		Key:              prefixedKey(date),
+		SortKey:          currency.Code,
+		ExchangeRates:    rates,
+		UpdatedAt:        time.Now(),
+		ExpiresAt:        time.Now().AddDate(0, 0, ttlIntervalDays).Unix(),
+		SchemaVersion:    exchangeRateSchemaVersion,
+		WrittenByVersion: buildVersion,
+		Degraded:         pivot.Degraded,
+		SourceDate:       pivot.SourceDate,
+		Suspect:          pivot.Suspect,
+		RateTimestamp:    pivot.RateTimestamp,
+		Derived:          true,
+		Formula:          currency.Formula,
+	}
+
+	item, err := attributevalue.MarshalMap(record)
+	if err != nil {
+		return fmt.Errorf("error marshaling derived record for %s: %w", currency.Code, err)
+	}
+
+	_, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(tableName),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("error storing derived rates for %s: %w", currency.Code, err)
+	}
+	return nil
+}
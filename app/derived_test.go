@@ -0,0 +1,103 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestLoadDerivedCurrencies(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    []DerivedCurrency
+		wantErr bool
+	}{
+		{
+			name:  "baskets sorted by code",
+			value: `{"XPG": {"USD": 2}, "XBK": {"GBP": 0.4, "EUR": 0.5}}`,
+			want: []DerivedCurrency{
+				{Code: "XBK", Weights: map[string]float64{"EUR": 0.5, "GBP": 0.4}, Formula: "0.5*EUR + 0.4*GBP"},
+				{Code: "XPG", Weights: map[string]float64{"USD": 2}, Formula: "2*USD"},
+			},
+		},
+		{name: "unset", value: ""},
+		{name: "not an object", value: `["XBK"]`, wantErr: true},
+		{name: "no components", value: `{"XBK": {}}`, wantErr: true},
+		{name: "invalid code", value: `{"basket": {"EUR": 1}}`, wantErr: true},
+		{name: "component is itself", value: `{"XBK": {"XBK": 1}}`, wantErr: true},
+		{name: "zero weight", value: `{"XBK": {"EUR": 0}}`, wantErr: true},
+		{name: "negative weight", value: `{"XBK": {"EUR": -0.5}}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := loadDerivedCurrencies(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadDerivedCurrencies() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("loadDerivedCurrencies() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeriveRates(t *testing.T) {
+	previousPivot, previousMode, previousDecimals := pairPivot, selfRateMode, roundDecimals
+	t.Cleanup(func() { pairPivot, selfRateMode, roundDecimals = previousPivot, previousMode, previousDecimals })
+	pairPivot, selfRateMode, roundDecimals = "USD", selfRateInclude, -1
+
+	pivotRates := map[string]float64{"USD": 1, "EUR": 0.5, "GBP": 0.8}
+	withoutSelfRate := map[string]float64{"EUR": 0.5, "GBP": 0.8}
+
+	tests := []struct {
+		name        string
+		currency    DerivedCurrency
+		pivotRates  map[string]float64
+		wantRates   map[string]float64
+		wantMissing []string
+	}{
+		{
+			name:       "basket",
+			currency:   DerivedCurrency{Code: "XBK", Weights: map[string]float64{"EUR": 0.5, "GBP": 0.4}},
+			pivotRates: pivotRates,
+			wantRates:  map[string]float64{"USD": 1.5, "EUR": 0.75, "GBP": 1.2, "XBK": 1},
+		},
+		{
+			name:       "fixed peg",
+			currency:   DerivedCurrency{Code: "XPG", Weights: map[string]float64{"USD": 2}},
+			pivotRates: pivotRates,
+			wantRates:  map[string]float64{"USD": 2, "EUR": 1, "GBP": 1.6, "XPG": 1},
+		},
+		{
+			name:       "pivot component without a stored self rate",
+			currency:   DerivedCurrency{Code: "XPG", Weights: map[string]float64{"USD": 2}},
+			pivotRates: withoutSelfRate,
+			wantRates:  map[string]float64{"USD": 2, "EUR": 1, "GBP": 1.6, "XPG": 1},
+		},
+		{
+			name:        "missing components",
+			currency:    DerivedCurrency{Code: "XBK", Weights: map[string]float64{"JPY": 1, "CHF": 1, "EUR": 1}},
+			pivotRates:  pivotRates,
+			wantMissing: []string{"CHF", "JPY"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rates, missing := deriveRates(tt.currency, tt.pivotRates)
+			if !reflect.DeepEqual(missing, tt.wantMissing) {
+				t.Fatalf("deriveRates() missing = %v, want %v", missing, tt.wantMissing)
+			}
+			if len(rates) != len(tt.wantRates) {
+				t.Fatalf("deriveRates() = %v, want %v", rates, tt.wantRates)
+			}
+			for target, want := range tt.wantRates {
+				if got, ok := rates[target]; !ok || math.Abs(got-want) > 1e-12 {
+					t.Errorf("deriveRates()[%s] = %v, want %v", target, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Currencies listed per digest entry, the rest are only counted
+const errorDigestExampleCurrencies = 5
+
+// errorDigestOther groups the errors of types beyond ERROR_DIGEST_MAX_TYPES
+const errorDigestOther = "other"
+
+// ErrorDigestEntry summarizes the errors of one type raised at one stage during a run.
+type ErrorDigestEntry struct {
+	Type       string   `json:"type" dynamodbav:"Type"`
+	Stage      string   `json:"stage" dynamodbav:"Stage"`
+	Count      int      `json:"count" dynamodbav:"Count"`
+	Currencies []string `json:"currencies" dynamodbav:"Currencies"`
+	Example    string   `json:"example" dynamodbav:"Example"`
+}
+
+type recordedError struct {
+	currency string
+	stage    string
+	kind     string
+	message  string
+}
+
+// RecordError remembers an error of the currency for the run's error digest.
+func (s *RunStats) RecordError(baseCurrency, stage string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.errors = append(s.errors, recordedError{
+		currency: baseCurrency,
+		stage:    stage,
+		kind:     errorType(err),
+		message:  bodySnippet([]byte(redactSecrets(err.Error()))),
+	})
+}
+
+// ErrorDigest groups the recorded errors by stage and type, largest groups first. At most
+// ERROR_DIGEST_MAX_TYPES groups are returned; errors of further types are merged into a single
+// "other" group so the digest stays small however many distinct errors a run sees.
+func (s *RunStats) ErrorDigest() []ErrorDigestEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	groups := make(map[string]*ErrorDigestEntry)
+	var order []*ErrorDigestEntry
+	for _, recorded := range s.errors {
+		key := recorded.stage + "/" + recorded.kind
+		entry, ok := groups[key]
+		if !ok {
+			entry = &ErrorDigestEntry{Type: recorded.kind, Stage: recorded.stage, Example: recorded.message}
+			groups[key] = entry
+			order = append(order, entry)
+		}
+		entry.Count++
+		if len(entry.Currencies) < errorDigestExampleCurrencies {
+			entry.Currencies = append(entry.Currencies, recorded.currency)
+		}
+	}
+
+	sort.SliceStable(order, func(i, j int) bool { return order[i].Count > order[j].Count })
+
+	digest := make([]ErrorDigestEntry, 0, len(order))
+	for i, entry := range order {
+		if i < errorDigestMaxTypes {
+			digest = append(digest, *entry)
+			continue
+		}
+		if i == errorDigestMaxTypes {
+			digest = append(digest, ErrorDigestEntry{Type: errorDigestOther, Stage: errorDigestOther, Example: entry.Example})
+		}
+		other := &digest[len(digest)-1]
+		other.Count += entry.Count
+		for _, currency := range entry.Currencies {
+			if len(other.Currencies) < errorDigestExampleCurrencies {
+				other.Currencies = append(other.Currencies, currency)
+			}
+		}
+	}
+	return digest
+}
+
+// errorType names the kind of a processing error for grouping in the error digest.
+func errorType(err error) string {
+	var statusErr *ProviderStatusError
+	var resultErr *ProviderResultError
+	var timeoutErr *ProviderTimeoutError
+	var pinErr *ProviderPinError
+	var nonJSONErr *ProviderNonJSONError
+	switch {
+	case errors.As(err, &statusErr):
+		return fmt.Sprintf("provider_status_%d", statusErr.StatusCode)
+	case errors.As(err, &resultErr):
+		return "provider_result"
+	case errors.As(err, &timeoutErr):
+		return "provider_timeout"
+	case errors.As(err, &pinErr):
+		return "provider_pin"
+	case errors.As(err, &nonJSONErr):
+		return "provider_non_json"
+	case errors.Is(err, errProviderEmptyRates):
+		return "provider_empty_rates"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "deadline_exceeded"
+	case errors.Is(err, context.Canceled):
+		return "cancelled"
+	default:
+		return "error"
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/sirupsen/logrus"
+)
+
+// SendMessageBatch accepts at most ten messages per call
+const failureQueueBatchSize = 10
+
+// Processing stages a failure can be reported from
+const (
+	failureStageCheck = "check"
+	failureStageFetch = "fetch"
+	failureStageStore = "store"
+)
+
+// FailureMessage is the body of a failure queue message. It never carries the API key.
+type FailureMessage struct {
+	Currency   string    `json:"currency"`
+	Date       string    `json:"date"`
+	Stage      string    `json:"stage"`
+	Error      string    `json:"error"`
+	RunID      string    `json:"run_id"`
+	Provider   string    `json:"provider"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// failureQueueEnabled reports whether currency failures are published to FAILURE_QUEUE_URL.
+func failureQueueEnabled() bool {
+	return failureQueueURL != ""
+}
+
+// queueFailure buffers a failure of the currency for publishing at the end of the run.
+func (r *currencyRun) queueFailure(baseCurrency, stage string, failure error) {
+	if !failureQueueEnabled() {
+		return
+	}
+	r.failures = append(r.failures, FailureMessage{
+		Currency:   baseCurrency,
+		Date:       r.date,
+		Stage:      stage,
+		Error:      redactSecrets(failure.Error()),
+		RunID:      r.id,
+		Provider:   activeProviderName(),
+		OccurredAt: time.Now().UTC(),
+	})
+}
+
+// dropFailures discards the buffered failures of a currency that is about to be retried.
+func (r *currencyRun) dropFailures(baseCurrency string) {
+	kept := r.failures[:0]
+	for _, failure := range r.failures {
+		if failure.Currency != baseCurrency {
+			kept = append(kept, failure)
+		}
+	}
+	r.failures = kept
+}
+
+// redactSecrets removes the API key from text, since provider URLs embed it and end up in
+// transport errors.
+func redactSecrets(text string) string {
+	if apiKey == "" {
+		return text
+	}
+	return strings.ReplaceAll(text, apiKey, "REDACTED")
+}
+
+// publishFailures sends the buffered failures to the failure queue in batches. Publishing is
+// best effort: failed sends are logged and never fail the run.
+func publishFailures(ctx context.Context, failures []FailureMessage) {
+	if !failureQueueEnabled() || len(failures) == 0 {
+		return
+	}
+
+	sent := 0
+	for start := 0; start < len(failures); start += failureQueueBatchSize {
+		end := min(start+failureQueueBatchSize, len(failures))
+
+		entries := make([]types.SendMessageBatchRequestEntry, 0, end-start)
+		for i, failure := range failures[start:end] {
+			body, err := json.Marshal(failure)
+			if err != nil {
+				logrus.WithError(err).WithField("currency", failure.Currency).Warn("Failed to marshal failure message")
+				continue
+			}
+			entries = append(entries, types.SendMessageBatchRequestEntry{
+				Id:          aws.String(strconv.Itoa(start + i)),
+				MessageBody: aws.String(string(body)),
+			})
+		}
+		if len(entries) == 0 {
+			continue
+		}
+
+		result, err := sqsClient.SendMessageBatch(ctx, &sqs.SendMessageBatchInput{
+			QueueUrl: aws.String(failureQueueURL),
+			Entries:  entries,
+		})
+		if err != nil {
+			logrus.WithError(err).WithField("messages", len(entries)).Warn("Failed to publish failures to the failure queue")
+			continue
+		}
+		for _, failed := range result.Failed {
+			logrus.WithFields(logrus.Fields{
+				"message_id": aws.ToString(failed.Id),
+				"code":       aws.ToString(failed.Code),
+			}).Warn("Failure queue rejected a message")
+		}
+		sent += len(result.Successful)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"sent":   sent,
+		"queued": len(failures),
+	}).Info("Published currency failures to the failure queue")
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/sirupsen/logrus"
+)
+
+// In hybrid storage mode only the hybrid base (USD) is fetched and stored with its full rate
+// map. Every other supported currency gets a lightweight view record under the same date whose
+// ViewOf attribute points at the base record; readers resolve it with resolveExchangeRateView.
+
+// hybridCurrencyOrder moves the hybrid base to the front of currencies, adding it when it is not
+// configured, so its authoritative map is stored before any view references it.
+func hybridCurrencyOrder(currencies []string) []string {
+	ordered := make([]string, 0, len(currencies)+1)
+	ordered = append(ordered, hybridBase)
+	for _, currency := range currencies {
+		if currency != hybridBase {
+			ordered = append(ordered, currency)
+		}
+	}
+	return ordered
+}
+
+// storeExchangeRateView stores a view record for baseCurrency pointing at the hybrid base record
+// for date. The base record must already exist and list baseCurrency, otherwise the view could
+// not be resolved.
+func storeExchangeRateView(ctx context.Context, logger *logrus.Entry, baseCurrency, date string) error {
+	reference, err := checkExistingExchangeRates(ctx, hybridBase, date)
+	if err != nil {
+		return err
+	}
+	if reference == nil {
+		return fmt.Errorf("no %s exchange rates stored for %s to reference", hybridBase, date)
+	}
+	if rate, ok := reference.ExchangeRates[baseCurrency]; !ok || rate <= 0 {
+		return fmt.Errorf("%s exchange rates for %s have no rate for %s", hybridBase, date, baseCurrency)
+	}
+
+	record := ExchangeRateRecord{
+		Key:              prefixedKey(date),
+		SortKey:          baseCurrency,
+		ViewOf:           hybridBase,
+		RateTimestamp:    reference.RateTimestamp,
+		Degraded:         reference.Degraded,
+		SourceDate:       reference.SourceDate,
+		Suspect:          reference.Suspect,
+		UpdatedAt:        time.Now(),
+		ExpiresAt:        time.Now().AddDate(0, 0, ttlIntervalDays).Unix(),
+		SchemaVersion:    exchangeRateSchemaVersion,
+		WrittenByVersion: buildVersion,
+	}
+
+	item, err := attributevalue.MarshalMap(record)
+	if err != nil {
+		return fmt.Errorf("error marshaling view record for %s: %w", baseCurrency, err)
+	}
+
+	_, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(tableName),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("error storing view record for %s: %w", baseCurrency, err)
+	}
+
+	logger.WithFields(logrus.Fields{
+		"date":    date,
+		"view_of": hybridBase,
+	}).Debug("Successfully stored exchange rate view to DynamoDB")
+	return nil
+}
+
+// resolveExchangeRates reads the record for baseCurrency on date, resolving view records to
+// full rate maps. It returns nil when no record exists.
+func resolveExchangeRates(ctx context.Context, baseCurrency, date string) (*ExchangeRateRecord, error) {
+	record, err := checkExistingExchangeRates(ctx, baseCurrency, date)
+	if err != nil || record == nil {
+		return record, err
+	}
+	if err := resolveExchangeRateView(ctx, record, nil); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// resolveExchangeRateView fills in the rates of a view record from the record it references,
+// computing cross rates as reference[target] / reference[base]. The reference is taken from
+// loaded when present there, otherwise read from the table. Full records are left untouched.
+func resolveExchangeRateView(ctx context.Context, record *ExchangeRateRecord, loaded map[string]*ExchangeRateRecord) error {
+	if record.ViewOf == "" {
+		return nil
+	}
+
+	reference := loaded[record.ViewOf]
+	if reference == nil {
+		var err error
+		reference, err = checkExistingExchangeRates(ctx, record.ViewOf, record.Key)
+		if err != nil {
+			return err
+		}
+		if reference == nil {
+			return fmt.Errorf("view %s on %s references missing %s exchange rates", record.SortKey, record.Key, record.ViewOf)
+		}
+	}
+
+	baseRate, ok := reference.ExchangeRates[record.SortKey]
+	if !ok || baseRate <= 0 {
+		return fmt.Errorf("view %s on %s has no usable rate in the %s exchange rates", record.SortKey, record.Key, record.ViewOf)
+	}
+
+	rates := make(map[string]float64, len(reference.ExchangeRates)+1)
+	for target, rate := range reference.ExchangeRates {
+		rates[target] = rate / baseRate
+	}
+	// The reference map has no self rate with SELF_RATE_MODE exclude, the view's map follows suit
+	rates[record.ViewOf] = 1 / baseRate
+	if selfRateMode == selfRateExclude {
+		delete(rates, record.SortKey)
+	} else {
+		rates[record.SortKey] = 1
+	}
+	record.ExchangeRates = rates
+	return nil
+}
@@ -2,35 +2,121 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"maps"
 	"net/http"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
+	// Embedded zone database, the provided.al2 runtime does not ship one
+	_ "time/tzdata"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// Schema versions written on each record type. Every type is versioned on its own, so a change
+// to one record's shape does not bump the others. Records stored before versioning was
+// introduced have no SchemaVersion attribute and unmarshal as version 0.
+const (
+	exchangeRateSchemaVersion        = 8
+	supportedCurrenciesSchemaVersion = 2
+	pairRateSchemaVersion            = 1
+	providerCacheSchemaVersion       = 1
+	runStatusSchemaVersion           = 2
+	runCursorSchemaVersion           = 1
+	currencyFailuresSchemaVersion    = 1
+	deadLetterSchemaVersion          = 1
+	runLockSchemaVersion             = 1
+)
+
+// BatchGetItem chunking for the upfront existence check
+const (
+	batchGetChunkSize  = 25
+	batchGetMaxRetries = 5
+)
+
+// supportedCurrenciesKey is the partition key of the supported currencies configuration record.
+const supportedCurrenciesKey = "SupportedCurrencies"
+
+// buildVersion is injected at build time via -ldflags "-X main.buildVersion=..."
+var buildVersion = "unknown"
+
+// ExchangeRateResponse is a provider response read through the provider's ProviderFieldMapping.
 type ExchangeRateResponse struct {
-	Result          string             `json:"result"`
-	BaseCode        string             `json:"base_code"`
-	ConversionRates map[string]float64 `json:"conversion_rates"`
+	Result          string
+	BaseCode        string
+	ConversionRates ProviderRates
+	// Bid and ask prices are only returned by some provider plans
+	BidRates ProviderRates
+	AskRates ProviderRates
+
+	// Provider publish time: v6 sends unix and UTC string forms, v4 only time_last_updated
+	TimeLastUpdateUnix int64
+	TimeLastUpdateUTC  string
+	TimeLastUpdated    int64
+	// When the provider expects to publish next, v6 only
+	TimeNextUpdateUnix int64
+
+	// Suspect is set locally when the response looks degraded but is stored anyway
+	Suspect bool
+	// RateTimestamp is the parsed provider publish time in UTC, or our fetch time as a fallback
+	RateTimestamp time.Time
+	// FetchMeta describes the HTTP exchange that returned the rates; nil for cache hits
+	FetchMeta *FetchMeta
+}
+
+type RateSpread struct {
+	Bid float64 `dynamodbav:"Bid"`
+	Ask float64 `dynamodbav:"Ask"`
 }
 
 type ExchangeRateRecord struct {
-	Key           string             `dynamodbav:"Key"`
-	SortKey       string             `dynamodbav:"SortKey"`
-	ExchangeRates map[string]float64 `dynamodbav:"ExchangeRates"`
-	UpdatedAt     time.Time          `dynamodbav:"UpdatedAt"`
-	ExpiresAt     int64              `dynamodbav:"ExpiresAt"`
+	Key              string                `dynamodbav:"Key"`
+	SortKey          string                `dynamodbav:"SortKey"`
+	ExchangeRates    map[string]float64    `dynamodbav:"ExchangeRates"`
+	Spreads          map[string]RateSpread `dynamodbav:"Spreads,omitempty"`
+	UpdatedAt        time.Time             `dynamodbav:"UpdatedAt"`
+	ExpiresAt        int64                 `dynamodbav:"ExpiresAt"`
+	SchemaVersion    int                   `dynamodbav:"SchemaVersion"`
+	WrittenByVersion string                `dynamodbav:"WrittenByVersion,omitempty"`
+
+	// Degraded records are copies of an earlier day's rates stored after a failed fetch
+	Degraded   bool   `dynamodbav:"Degraded,omitempty"`
+	SourceDate string `dynamodbav:"SourceDate,omitempty"`
+
+	// Suspect records had far fewer targets than the previous day
+	Suspect bool `dynamodbav:"Suspect,omitempty"`
+
+	// RateTimestamp is when the provider published the rates, in UTC
+	RateTimestamp time.Time `dynamodbav:"RateTimestamp"`
+
+	// ViewOf marks a hybrid storage view without its own rates; it names the base currency
+	// record under the same date that the rates are derived from
+	ViewOf string `dynamodbav:"ViewOf,omitempty"`
+
+	// Derived records are computed locally from the pivot record using Formula
+	Derived bool   `dynamodbav:"Derived,omitempty"`
+	Formula string `dynamodbav:"Formula,omitempty"`
+
+	// Source identifies the region or deployment that wrote the record
+	Source string `dynamodbav:"Source,omitempty"`
+
+	// FetchMeta records how the provider responded, only when STORE_FETCH_META is enabled
+	FetchMeta *FetchMeta `dynamodbav:"FetchMeta,omitempty"`
 }
 
 type SupportedCurrenciesRecord struct {
@@ -39,20 +125,196 @@ type SupportedCurrenciesRecord struct {
 	SupportedCurrencies []string  `dynamodbav:"SupportedCurrencies"`
 	UpdatedAt           time.Time `dynamodbav:"UpdatedAt"`
 	ExpiresAt           time.Time `dynamodbav:"ExpiresAt"`
+	SchemaVersion       int       `dynamodbav:"SchemaVersion"`
+	WrittenByVersion    string    `dynamodbav:"WrittenByVersion,omitempty"`
 }
 
 var (
-	dynamoClient        *dynamodb.Client
-	tableName           string
-	apiKey              string
-	supportedCurrencies []string
-	ttlIntervalDays     int
+	dynamoClient          *dynamodb.Client
+	tableName             string
+	keyPrefix             string
+	logStreamField        bool
+	apiKey                string
+	supportedCurrencies   []string
+	ttlIntervalDays       int
+	captureSpreads        bool
+	storeFetchMeta        bool
+	deadLetterThreshold   int
+	deadLetterSkip        bool
+	handlerMode           string
+	providerProfiles      map[string]ProviderProfile
+	providerFieldMappings map[string]ProviderFieldMapping
+	otelEnabled           bool
+	filterPegged          bool
+	rateDropPercent       int
+	rateDropPolicy        string
+	peggedCurrencies      map[string]bool
+	currencyCodeRemap     map[string]string
+	useLastKnownGood      bool
+	lastKnownGoodDays     int
+	priorityCurrencies    map[string]bool
+	apiGzipMinBytes       int
+
+	// Provider call budget per invocation, 0 means unlimited
+	maxProviderCallsPerRun int
+
+	// Stored cursor letting each run continue where the budget stopped the previous one
+	runCursorEnabled bool
+
+	// Time an invocation must have left at entry to start a run, 0 only checks for cancellation
+	minTimeBudgetSeconds int
+
+	// Time zone whose calendar day the stored records are bucketed by
+	dateLocation *time.Location
+
+	// Current time for date computation, replaced in tests
+	clock = time.Now
+
+	// Optional lock serializing overlapping runs, held for at most the lease
+	runLockEnabled      bool
+	runLockLeaseSeconds int
+
+	// Hybrid storage: one full map for hybridBase per day plus view records for the rest
+	hybridStorage bool
+	hybridBase    string
+
+	// Currencies and pairs the provider is known never to serve, skipped without a fetch
+	knownUnsupportedCurrencies map[string]bool
+	knownUnsupportedPairs      map[CurrencyPair]bool
+
+	// Pairs that must be stored every day, triangulated through the pivot when needed
+	requiredPairs []CurrencyPair
+	pairPivot     string
+
+	// Currencies computed locally from the pivot record, never fetched
+	derivedCurrencies []DerivedCurrency
+
+	// Reuse of provider responses within a publish cycle: none, memory or dynamodb
+	providerCacheMode string
+
+	// Whether stored maps carry the base->base rate of 1.0: include or exclude
+	selfRateMode string
+
+	// Source stamped on stored records and the policy for records written by other sources
+	writeSource         string
+	writeConflictPolicy string
+
+	// Plausible ranges per pair and what to do with rates outside them: drop, flag or skip
+	rateBounds       map[CurrencyPair]RateBounds
+	rateBoundsPolicy string
+
+	// Decimal rounding of stored rates, disabled when roundDecimals is negative
+	roundDecimals int
+	roundMode     string
+
+	// Significant digits rounding always keeps, globally and per target currency
+	roundSignificantDigits     int
+	roundSignificantByCurrency map[string]int
+
+	// Durable failure records for a separate consumer, disabled unless FAILURE_QUEUE_URL is set
+	sqsClient       *sqs.Client
+	failureQueueURL string
+
+	// End-of-run retry of the currencies that failed, bounded by a time budget
+	secondPassEnabled       bool
+	secondPassDelayMs       int
+	secondPassBudgetSeconds int
+
+	// Size of the run's error digest and whether it is kept on the run status record
+	errorDigestMaxTypes int
+	errorDigestStore    bool
+
+	// Distinct signal for runs that found every record already current
+	noOpRunSignal bool
+
+	// Post-run check that every supported currency has a record for today
+	validationSweep      bool
+	validationSweepAlert bool
+
+	// CloudWatch metrics as EMF log lines or PutMetricData calls, disabled unless METRICS_MODE is set
+	cloudwatchClient *cloudwatch.Client
+	metricsMode      string
+	metricsStage     string
+
+	// Cold start check of the configured currencies against the provider's supported codes
+	verifyProviderCodesEnabled bool
+	verifyCodesPolicy          string
+
+	// Daily rate report upload, disabled unless REPORT_BUCKET is set
+	s3Client     *s3.Client
+	reportBucket string
+	reportPrefix string
+	reportFormat string
+
+	// Retries of the lazy AWS client setup at the start of an invocation
+	initMaxAttempts int
+	initBackoffMs   int
+
+	// Optional JSON config object in S3 merged over the environment
+	configS3URI          string
+	configRefreshSeconds int
+
+	// HTTP client used for all provider calls
+	httpClient                 *http.Client
+	httpClientSettings         string
+	httpMaxIdleConns           int
+	httpMaxIdleConnsPerHost    int
+	httpIdleConnTimeoutSeconds int
+	tlsPins                    [][]byte
+	tlsMinVersion              uint16
+	tlsCipherSuites            []uint16
 )
 
-func init() {
+// setup runs once per container before the first invocation. It lives outside init() so the
+// package can be loaded by tests without a Lambda environment.
+func setup() {
 	// Configure logrus
 	logrus.SetFormatter(&logrus.JSONFormatter{})
 
+	// AWS clients are created lazily by ensureAWSClients, see awsinit.go
+	env := &envReader{}
+	initMaxAttempts = env.Int("INIT_MAX_ATTEMPTS", 3)
+	initBackoffMs = env.Int("INIT_BACKOFF_MS", 200)
+	configS3URI = os.Getenv("CONFIG_S3_URI")
+	configRefreshSeconds = env.Int("CONFIG_REFRESH_SECONDS", 0)
+	if env.err != nil {
+		logrus.WithError(env.err).Fatal("Invalid settings")
+	}
+	if initMaxAttempts < 1 || initBackoffMs < 0 {
+		logrus.WithFields(logrus.Fields{
+			"max_attempts": initMaxAttempts,
+			"backoff_ms":   initBackoffMs,
+		}).Fatal("INIT_MAX_ATTEMPTS must be at least 1 and INIT_BACKOFF_MS non-negative")
+	}
+
+	// An optional config object from S3 overrides environment variables. It is read before the
+	// settings are validated, so an object that cannot be read or is invalid stops the function
+	if configS3URI != "" {
+		if err := loadConfigObject(context.Background()); err != nil {
+			logrus.WithError(err).WithField("config_uri", configS3URI).Fatal("Failed to load configuration")
+		}
+	}
+
+	if err := loadSettings(); err != nil {
+		logrus.WithError(err).Fatal("Invalid settings")
+	}
+
+	// OpenTelemetry stays a no-op unless explicitly enabled
+	otelEnabled = env.Bool("OTEL_ENABLED", false)
+	if env.err != nil {
+		logrus.WithError(env.err).Fatal("Invalid settings")
+	}
+	setupTelemetry(context.Background())
+
+	if verifyProviderCodesEnabled && handlerMode != "api" {
+		verifyProviderCodes(context.Background())
+	}
+}
+
+// loadSettings parses and validates every setting from the environment, returning the first
+// invalid value as an error. It runs at cold start, where an error stops the function, and
+// again when refreshConfig applies a changed S3 config object.
+func loadSettings() error {
 	// Set log level from environment variable
 	logLevel := os.Getenv("LOG_LEVEL")
 	switch strings.ToLower(logLevel) {
@@ -70,25 +332,274 @@ func init() {
 
 	logrus.WithField("log_level", logrus.GetLevel().String()).Info("Logger configured")
 
-	cfg, err := config.LoadDefaultConfig(context.TODO())
-	if err != nil {
-		logrus.WithError(err).Fatal("unable to load SDK config")
-	}
+	env := &envReader{}
+	var err error
 
-	dynamoClient = dynamodb.NewFromConfig(cfg)
 	tableName = os.Getenv("EXCHANGE_RATE_DB_NAME")
+	keyPrefix = os.Getenv("KEY_PREFIX")
+
+	// The day boundary follows TIMEZONE, UTC unless configured
+	if dateLocation, err = loadDateLocation(os.Getenv("TIMEZONE")); err != nil {
+		return err
+	}
+	logStreamField = env.Bool("LOG_STREAM_FIELD", false)
+	handlerMode = os.Getenv("HANDLER_MODE")
 	apiKey = os.Getenv("EXCHANGE_RATE_API_KEY")
 
+	// Read API responses at least this large are gzipped for clients that accept it
+	apiGzipMinBytes = env.Int("API_GZIP_MIN_BYTES", 1024)
+
 	// Parse TTL interval days
-	ttlIntervalDaysStr := os.Getenv("TTL_INTERVAL_DAYS")
-	if ttlIntervalDaysStr != "" {
-		var err error
-		ttlIntervalDays, err = strconv.Atoi(ttlIntervalDaysStr)
-		if err != nil {
-			logrus.WithError(err).Fatal("TTL_INTERVAL_DAYS must be a valid integer")
-		}
-	} else {
-		ttlIntervalDays = 30 // Default to 30 days
+	ttlIntervalDays = env.Int("TTL_INTERVAL_DAYS", 30) // Default to 30 days
+
+	// Bid/ask capture is opt-in since most provider plans only return mid rates
+	captureSpreads = env.Bool("CAPTURE_SPREADS", false)
+
+	// Fetch diagnostics add an attribute to every record, so they are opt-in as well
+	storeFetchMeta = env.Bool("STORE_FETCH_META", false)
+
+	// Dead-letter tracking is disabled unless a threshold is configured
+	deadLetterThreshold = env.Int("DEAD_LETTER_THRESHOLD", 0)
+	deadLetterSkip = env.Bool("DEAD_LETTER_SKIP", false)
+
+	// Carrying forward the last known good rates is opt-in and bounded by a lookback window
+	useLastKnownGood = env.Bool("USE_LAST_KNOWN_GOOD", false)
+	lastKnownGoodDays = env.Int("LAST_KNOWN_GOOD_MAX_DAYS", 7)
+
+	// Comparing the rate count against the previous day is off by default
+	rateDropPercent = env.Int("RATE_COUNT_DROP_PERCENT", 0)
+	rateDropPolicy = strings.ToLower(os.Getenv("RATE_COUNT_DROP_POLICY"))
+	if rateDropPolicy == "" {
+		rateDropPolicy = "skip"
+	}
+	if rateDropPolicy != "skip" && rateDropPolicy != "flag" {
+		return fmt.Errorf("RATE_COUNT_DROP_POLICY must be skip or flag, got %q", rateDropPolicy)
+	}
+
+	// Absolute bounds catch absurd values even without a previous day to compare against
+	if rateBounds, err = loadRateBounds(os.Getenv("RATE_BOUNDS")); err != nil {
+		return err
+	}
+	rateBoundsPolicy = strings.ToLower(os.Getenv("RATE_BOUNDS_POLICY"))
+	if rateBoundsPolicy == "" {
+		rateBoundsPolicy = rateBoundsDrop
+	}
+	if rateBoundsPolicy != rateBoundsDrop && rateBoundsPolicy != rateBoundsFlag && rateBoundsPolicy != rateBoundsSkip {
+		return fmt.Errorf("RATE_BOUNDS_POLICY must be drop, flag or skip, got %q", rateBoundsPolicy)
+	}
+
+	// The source defaults to the Lambda's region; conflicts are not checked unless configured
+	writeSource = os.Getenv("WRITE_SOURCE")
+	if writeSource == "" {
+		writeSource = os.Getenv("AWS_REGION")
+	}
+	writeConflictPolicy = strings.ToLower(os.Getenv("WRITE_CONFLICT_POLICY"))
+	if writeConflictPolicy == "" {
+		writeConflictPolicy = writeConflictOff
+	}
+	if writeConflictPolicy != writeConflictOff && writeConflictPolicy != writeConflictLog && writeConflictPolicy != writeConflictReject {
+		return fmt.Errorf("WRITE_CONFLICT_POLICY must be off, log or reject, got %q", writeConflictPolicy)
+	}
+	if writeConflictPolicy != writeConflictOff && writeSource == "" {
+		return errors.New("WRITE_CONFLICT_POLICY requires WRITE_SOURCE or AWS_REGION to identify this source")
+	}
+
+	failureQueueURL = os.Getenv("FAILURE_QUEUE_URL")
+
+	// Failed currencies are not retried as a whole unless the second pass is enabled
+	secondPassEnabled = env.Bool("SECOND_PASS_ENABLED", false)
+	secondPassDelayMs = env.Int("SECOND_PASS_DELAY_MS", 5000)
+	secondPassBudgetSeconds = env.Int("SECOND_PASS_BUDGET_SECONDS", 60)
+
+	// Runs that change nothing are only signalled when asked for
+	noOpRunSignal = env.Bool("NOOP_RUN_SIGNAL", false)
+
+	// The error digest is always logged, storing it on the run status record is opt-in
+	errorDigestMaxTypes = env.Int("ERROR_DIGEST_MAX_TYPES", 10)
+	if errorDigestMaxTypes < 1 {
+		return fmt.Errorf("ERROR_DIGEST_MAX_TYPES must be at least 1, got %d", errorDigestMaxTypes)
+	}
+	errorDigestStore = env.Bool("ERROR_DIGEST_STORE", false)
+
+	// Invocations delivered with less time than this left are skipped up front
+	minTimeBudgetSeconds = env.Int("MIN_TIME_BUDGET_SECONDS", 5)
+	if minTimeBudgetSeconds < 0 {
+		return fmt.Errorf("MIN_TIME_BUDGET_SECONDS must be non-negative, got %d", minTimeBudgetSeconds)
+	}
+	if secondPassDelayMs < 0 || secondPassBudgetSeconds <= 0 {
+		return fmt.Errorf("SECOND_PASS_DELAY_MS must be non-negative and SECOND_PASS_BUDGET_SECONDS positive, got %d and %d", secondPassDelayMs, secondPassBudgetSeconds)
+	}
+
+	// Overlapping runs are not prevented unless the run lock is enabled
+	runLockEnabled = env.Bool("RUN_LOCK_ENABLED", false)
+	runLockLeaseSeconds = env.Int("RUN_LOCK_LEASE_SECONDS", 900)
+	if runLockLeaseSeconds <= 0 {
+		return fmt.Errorf("RUN_LOCK_LEASE_SECONDS must be positive, got %d", runLockLeaseSeconds)
+	}
+
+	// Hybrid storage is opt-in since it changes what readers have to resolve
+	hybridStorage = env.Bool("HYBRID_STORAGE", false)
+	hybridBase = "USD"
+
+	// Permanently unavailable currencies and pairs are neither fetched nor counted as errors
+	if knownUnsupportedCurrencies, knownUnsupportedPairs, err = loadKnownUnsupported(getEnvList("KNOWN_UNSUPPORTED")); err != nil {
+		return err
+	}
+
+	// Required pairs are resolved from the stored records after the run
+	if requiredPairs, err = parseRequiredPairs(getEnvList("REQUIRED_PAIRS")); err != nil {
+		return err
+	}
+	pairPivot = strings.ToUpper(os.Getenv("PAIR_PIVOT"))
+	if pairPivot != "" && !isCurrencyCode(pairPivot) {
+		return fmt.Errorf("PAIR_PIVOT must be a currency code, got %q", pairPivot)
+	}
+
+	// Provider response caching is off by default
+	providerCacheMode = strings.ToLower(os.Getenv("PROVIDER_CACHE"))
+	if providerCacheMode == "" {
+		providerCacheMode = providerCacheNone
+	}
+	if providerCacheMode != providerCacheNone && providerCacheMode != providerCacheMemory && providerCacheMode != providerCacheDynamoDB {
+		return fmt.Errorf("PROVIDER_CACHE must be none, memory or dynamodb, got %q", providerCacheMode)
+	}
+
+	// Derived currencies are computed from the same pivot record as the required pairs
+	if derivedCurrencies, err = loadDerivedCurrencies(os.Getenv("DERIVED_CURRENCIES")); err != nil {
+		return err
+	}
+
+	// The post-run completeness check costs an extra batch read, so it is opt-in
+	validationSweep = env.Bool("VALIDATION_SWEEP", false)
+	validationSweepAlert = env.Bool("VALIDATION_SWEEP_ALERT", false)
+
+	// Metrics are written as EMF log lines, which CloudWatch extracts without extra API calls,
+	// or published with PutMetricData at the end of each invocation
+	metricsMode = strings.ToLower(os.Getenv("METRICS_MODE"))
+	if metricsMode == "" {
+		metricsMode = metricsModeNone
+	}
+	if metricsMode != metricsModeEMF && metricsMode != metricsModeAPI && metricsMode != metricsModeNone {
+		return fmt.Errorf("METRICS_MODE must be emf, api or none, got %q", metricsMode)
+	}
+	metricsStage = os.Getenv("METRICS_STAGE")
+	if metricsStage == "" {
+		metricsStage = "default"
+	}
+
+	// Provider calls per run are unlimited unless a budget is configured
+	maxProviderCallsPerRun = env.Int("MAX_PROVIDER_CALLS_PER_RUN", 0)
+	runCursorEnabled = env.Bool("RUN_CURSOR", false)
+
+	// Priority currencies are processed before the rest of the list
+	priorityCurrencies = make(map[string]bool)
+	for _, currency := range getEnvList("PRIORITY_CURRENCIES") {
+		priorityCurrencies[currency] = true
+	}
+
+	// Verifying configured currencies against the provider costs a call at cold start, so it is opt-in
+	verifyProviderCodesEnabled = env.Bool("VERIFY_PROVIDER_CODES", false)
+	verifyCodesPolicy = strings.ToLower(os.Getenv("VERIFY_PROVIDER_CODES_POLICY"))
+	if verifyCodesPolicy == "" {
+		verifyCodesPolicy = "warn"
+	}
+	if verifyCodesPolicy != "warn" && verifyCodesPolicy != "fail" {
+		return fmt.Errorf("VERIFY_PROVIDER_CODES_POLICY must be warn or fail, got %q", verifyCodesPolicy)
+	}
+
+	// Parse daily report settings
+	reportBucket = os.Getenv("REPORT_BUCKET")
+	reportPrefix = os.Getenv("REPORT_PREFIX")
+	if reportPrefix == "" {
+		reportPrefix = "reports"
+	}
+	reportFormat = strings.ToLower(os.Getenv("REPORT_FORMAT"))
+	if reportFormat == "" {
+		reportFormat = reportFormatMarkdown
+	}
+	if reportFormat != reportFormatMarkdown && reportFormat != reportFormatHTML {
+		return fmt.Errorf("REPORT_FORMAT must be markdown or html, got %q", reportFormat)
+	}
+
+	// Provider code quirks, e.g. CNH reported where CNY is stored
+	if currencyCodeRemap, err = loadCurrencyCodeRemap(os.Getenv("CURRENCY_CODE_REMAP")); err != nil {
+		return err
+	}
+
+	// Stored maps carry the self rate unless configured otherwise
+	selfRateMode = strings.ToLower(os.Getenv("SELF_RATE_MODE"))
+	if selfRateMode == "" {
+		selfRateMode = selfRateInclude
+	}
+	if selfRateMode != selfRateInclude && selfRateMode != selfRateExclude {
+		return fmt.Errorf("SELF_RATE_MODE must be include or exclude, got %q", selfRateMode)
+	}
+
+	// Rates are stored as the provider sent them unless ROUND_DECIMALS is set
+	roundDecimals = env.Int("ROUND_DECIMALS", -1)
+	if roundDecimals < -1 || roundDecimals > 15 {
+		return fmt.Errorf("ROUND_DECIMALS must be between 0 and 15, got %d", roundDecimals)
+	}
+	roundMode = strings.ToLower(os.Getenv("ROUND_MODE"))
+	if roundMode == "" {
+		roundMode = roundHalfEven
+	}
+	if roundMode != roundHalfUp && roundMode != roundHalfEven && roundMode != roundDown && roundMode != roundUp {
+		return fmt.Errorf("ROUND_MODE must be half-up, half-even, down or up, got %q", roundMode)
+	}
+	roundSignificantDigits = env.Int("ROUND_SIGNIFICANT_DIGITS", 0)
+	if roundSignificantDigits < 0 || roundSignificantDigits > 17 {
+		return fmt.Errorf("ROUND_SIGNIFICANT_DIGITS must be between 0 and 17, got %d", roundSignificantDigits)
+	}
+	if roundSignificantByCurrency, err = loadRoundSignificantByCurrency(os.Getenv("ROUND_SIGNIFICANT_DIGITS_BY_CURRENCY")); err != nil {
+		return err
+	}
+
+	// Dropping pegged targets is off by default
+	filterPegged = env.Bool("FILTER_PEGGED_RATES", false)
+	peggedCurrencies = make(map[string]bool)
+	for _, currency := range getEnvList("PEGGED_CURRENCIES") {
+		peggedCurrencies[currency] = true
+	}
+
+	// Parse HTTP connection pool settings
+	httpMaxIdleConns = env.Int("HTTP_MAX_IDLE_CONNS", 100)
+	httpMaxIdleConnsPerHost = env.Int("HTTP_MAX_IDLE_CONNS_PER_HOST", 10)
+	httpIdleConnTimeoutSeconds = env.Int("HTTP_IDLE_CONN_TIMEOUT_SECONDS", 90)
+
+	// TLS baseline for provider calls; cipher suites only apply up to TLS 1.2
+	if tlsMinVersion, err = parseTLSVersion(os.Getenv("TLS_MIN_VERSION")); err != nil {
+		return err
+	}
+	if tlsCipherSuites, err = parseCipherSuites(getEnvList("TLS_CIPHER_SUITES")); err != nil {
+		return err
+	}
+
+	// Certificate pinning is opt-in, standard chain verification always applies
+	if tlsPins, err = loadTLSPins(getEnvList("TLS_PIN")); err != nil {
+		return err
+	}
+
+	// Every integer and boolean setting has been read by now
+	if env.err != nil {
+		return env.err
+	}
+
+	// Keep the pooled client and its idle connections across refreshes unless its settings changed
+	clientSettings := fmt.Sprint(httpMaxIdleConns, httpMaxIdleConnsPerHost, httpIdleConnTimeoutSeconds, tlsMinVersion, tlsCipherSuites, tlsPins)
+	if httpClient == nil || clientSettings != httpClientSettings {
+		httpClient = newHTTPClient()
+		httpClientSettings = clientSettings
+	}
+
+	// Parse per-provider timeout and retry profiles
+	if providerProfiles, err = loadProviderProfiles(os.Getenv("PROVIDER_PROFILES")); err != nil {
+		return err
+	}
+
+	// Response field names per provider, the built-in ones unless overridden
+	if providerFieldMappings, err = loadProviderFieldMappings(os.Getenv("PROVIDER_FIELD_MAPPING")); err != nil {
+		return err
 	}
 
 	// Parse supported currencies from environment variable
@@ -100,154 +611,648 @@ func init() {
 		supportedCurrencies = []string{"EUR", "GBP", "CHF", "SEK", "NOK", "DKK", "PLN", "CZK", "HUF", "RON", "UAH", "BYN", "RUB"}
 	}
 
+	for currency := range priorityCurrencies {
+		if !slices.Contains(supportedCurrencies, currency) {
+			logrus.WithField("currency", currency).Warn("Priority currency is not in SUPPORTED_CURRENCIES and will be ignored")
+		}
+	}
+
+	// Triangulation and derived currencies read the pivot's own record, so it must be fetched.
+	// Without PAIR_PIVOT it is USD when supported, otherwise the first supported currency
+	if pairPivot == "" {
+		pairPivot = "USD"
+		if !slices.Contains(supportedCurrencies, pairPivot) {
+			pairPivot = supportedCurrencies[0]
+		}
+	} else if !slices.Contains(supportedCurrencies, pairPivot) {
+		return fmt.Errorf("PAIR_PIVOT %s must be one of SUPPORTED_CURRENCIES", pairPivot)
+	}
+
+	for _, currency := range derivedCurrencies {
+		if slices.Contains(supportedCurrencies, currency.Code) {
+			return fmt.Errorf("DERIVED_CURRENCIES must not redefine %s, which is in SUPPORTED_CURRENCIES", currency.Code)
+		}
+	}
+
 	if tableName == "" {
-		logrus.Fatal("EXCHANGE_RATE_DB_NAME environment variable is required")
+		return errors.New("EXCHANGE_RATE_DB_NAME environment variable is required")
 	}
 
 	logrus.WithFields(logrus.Fields{
-		"table_name":           tableName,
-		"supported_currencies": supportedCurrencies,
-		"currencies_count":     len(supportedCurrencies),
-		"api_key_configured":   apiKey != "",
-		"ttl_interval_days":    ttlIntervalDays,
+		"table_name":            tableName,
+		"key_prefix":            keyPrefix,
+		"supported_currencies":  supportedCurrencies,
+		"currencies_count":      len(supportedCurrencies),
+		"api_key_configured":    apiKey != "",
+		"ttl_interval_days":     ttlIntervalDays,
+		"capture_spreads":       captureSpreads,
+		"store_fetch_meta":      storeFetchMeta,
+		"dead_letter_threshold": deadLetterThreshold,
+		"dead_letter_skip":      deadLetterSkip,
+		"use_last_known_good":   useLastKnownGood,
+		"filter_pegged_rates":   filterPegged,
+		"self_rate_mode":        selfRateMode,
+		"round_decimals":        roundDecimals,
+		"round_mode":            roundMode,
+		"round_significant":     roundSignificantDigits,
+		"rate_drop_percent":     rateDropPercent,
+		"rate_drop_policy":      rateDropPolicy,
+		"rate_bounds":           len(rateBounds),
+		"rate_bounds_policy":    rateBoundsPolicy,
+		"priority_currencies":   len(priorityCurrencies),
+		"max_provider_calls":    maxProviderCallsPerRun,
+		"run_cursor":            runCursorEnabled,
+		"metrics_mode":          metricsMode,
+		"validation_sweep":      validationSweep,
+		"run_lock_enabled":      runLockEnabled,
+		"second_pass_enabled":   secondPassEnabled,
+		"write_source":          writeSource,
+		"write_conflict_policy": writeConflictPolicy,
+		"required_pairs":        len(requiredPairs),
+		"derived_currencies":    len(derivedCurrencies),
+		"provider_cache":        providerCacheMode,
+		"hybrid_storage":        hybridStorage,
+		"verify_provider_codes": verifyProviderCodesEnabled,
+		"report_bucket":         reportBucket,
+		"report_format":         reportFormat,
+		"config_uri":            configS3URI,
+		"failure_queue":         failureQueueEnabled(),
 	}).Info("Exchange rate cooker initialized")
+
+	logrus.WithFields(logrus.Fields{
+		"max_idle_conns":          httpMaxIdleConns,
+		"max_idle_conns_per_host": httpMaxIdleConnsPerHost,
+		"idle_conn_timeout_sec":   httpIdleConnTimeoutSeconds,
+		"tls_pins":                len(tlsPins),
+		"tls_min_version":         tls.VersionName(tlsMinVersion),
+		"tls_cipher_suites":       len(tlsCipherSuites),
+	}).Debug("HTTP client configured")
+
+	for name, profile := range providerProfiles {
+		logrus.WithFields(logrus.Fields{
+			"provider":           name,
+			"active":             name == activeProviderName(),
+			"timeout_ms":         profile.TimeoutMs,
+			"connect_timeout_ms": profile.ConnectTimeoutMs,
+			"body_timeout_ms":    profile.BodyTimeoutMs,
+			"max_retries":        profile.MaxRetries,
+			"backoff_ms":         profile.BackoffMs,
+			"max_backoff_ms":     profile.MaxBackoffMs,
+		}).Info("Provider profile in effect")
+	}
+	return nil
 }
 
-func handler(ctx context.Context, event events.CloudWatchEvent) error {
+// currencyLogger returns the scoped entry that every log line about baseCurrency should go
+// through, so per-currency processing can be filtered reliably on the currency field. With
+// LOG_STREAM_FIELD enabled it also carries a stable log_stream value for subscription routing.
+func currencyLogger(baseCurrency string) *logrus.Entry {
+	fields := logrus.Fields{"currency": baseCurrency}
+	if logStreamField {
+		fields["log_stream"] = "currency/" + baseCurrency
+	}
+	return logrus.WithFields(fields)
+}
+
+// prefixedKey namespaces a partition key value with KEY_PREFIX so the table can be shared
+// with other services.
+func prefixedKey(key string) string {
+	return keyPrefix + key
+}
+
+// unprefixedKey strips KEY_PREFIX from a partition key value read back from the table.
+func unprefixedKey(key string) string {
+	return strings.TrimPrefix(key, keyPrefix)
+}
+
+// envReader reads typed environment variables. A value that does not parse reads as its
+// default and is kept as err, so a run of reads can be checked once at the end.
+type envReader struct {
+	err error
+}
+
+// Int reads an integer environment variable, falling back to defaultValue when unset.
+func (r *envReader) Int(name string, defaultValue int) int {
+	valueStr := os.Getenv(name)
+	if valueStr == "" {
+		return defaultValue
+	}
+
+	value, err := strconv.Atoi(valueStr)
+	if err != nil {
+		r.fail(fmt.Errorf("%s must be a valid integer: %w", name, err))
+		return defaultValue
+	}
+	return value
+}
+
+// Bool reads a boolean environment variable, falling back to defaultValue when unset.
+func (r *envReader) Bool(name string, defaultValue bool) bool {
+	valueStr := os.Getenv(name)
+	if valueStr == "" {
+		return defaultValue
+	}
+
+	value, err := strconv.ParseBool(valueStr)
+	if err != nil {
+		r.fail(fmt.Errorf("%s must be a valid boolean: %w", name, err))
+		return defaultValue
+	}
+	return value
+}
+
+// fail records err unless an earlier read already failed.
+func (r *envReader) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+// getEnvList reads a "|" separated environment variable, skipping empty entries.
+func getEnvList(name string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(name), "|") {
+		value = strings.TrimSpace(value)
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// loadDateLocation resolves TIMEZONE, an IANA zone name such as Europe/Madrid, and logs the
+// offset currently in effect.
+func loadDateLocation(name string) (*time.Location, error) {
+	if name == "" {
+		name = "UTC"
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("TIMEZONE must be a valid IANA time zone name: %w", err)
+	}
+
+	zone, offset := time.Now().In(location).Zone()
+	logrus.WithFields(logrus.Fields{
+		"timezone":       location.String(),
+		"zone":           zone,
+		"offset_seconds": offset,
+	}).Info("Date time zone resolved")
+	return location, nil
+}
+
+// todayDate returns today's date in the TIMEZONE location, the date records are stored
+// under. It converts the instant rather than building a local wall time, so DST transitions
+// cannot skip or repeat a date. Day arithmetic on the result parses it as a UTC calendar date,
+// where every day is 24 hours long.
+func todayDate() string {
+	return clock().In(dateLocation).Format("2006-01-02")
+}
+
+// errInsufficientTimeBudget is returned when an invocation starts already cancelled or with
+// less than MIN_TIME_BUDGET_SECONDS left, so no currency could be processed meaningfully.
+var errInsufficientTimeBudget = errors.New("insufficient time budget")
+
+// checkTimeBudget rejects an invocation before any work is attempted when its context is
+// already cancelled or about to expire, instead of running into a failure for every currency.
+func checkTimeBudget(ctx context.Context) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		logrus.WithError(ctxErr).Warn("Invocation context already cancelled, skipping run")
+		emitMetrics(map[string]interface{}{"BuildVersion": buildVersion}, Metric{Name: "InsufficientTimeBudget", Unit: "Count", Value: 1})
+		return fmt.Errorf("%w: %v", errInsufficientTimeBudget, ctxErr)
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return nil
+	}
+	remaining := time.Until(deadline)
+	minimum := time.Duration(minTimeBudgetSeconds) * time.Second
+	if remaining >= minimum {
+		return nil
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"remaining_ms":            remaining.Milliseconds(),
+		"min_time_budget_seconds": minTimeBudgetSeconds,
+	}).Warn("Not enough time left in the invocation, skipping run")
+	emitMetrics(map[string]interface{}{"BuildVersion": buildVersion}, Metric{Name: "InsufficientTimeBudget", Unit: "Count", Value: 1})
+	return fmt.Errorf("%w: %d ms left, %d s required", errInsufficientTimeBudget, remaining.Milliseconds(), minTimeBudgetSeconds)
+}
+
+func handler(ctx context.Context, event events.CloudWatchEvent) (err error) {
 	startTime := time.Now()
+	ctx, endRun := startSpan(ctx, "exchange_rate_cooker.run", runDuration)
+	defer func() {
+		endRun(err)
+		flushMetrics(ctx)
+		flushTelemetry(ctx)
+	}()
+
 	logrus.WithFields(logrus.Fields{
 		"event_time":   time.Now().Format(time.RFC3339),
 		"event_source": event.Source,
 		"event_id":     event.ID,
 	}).Info("Exchange rate cooker triggered")
 
+	if err := checkTimeBudget(ctx); err != nil {
+		return err
+	}
+
+	if err := ensureAWSClients(ctx); err != nil {
+		return err
+	}
+	refreshConfig(ctx)
+
+	if runLockEnabled {
+		owner := invocationID(ctx)
+		acquired, err := acquireRunLock(ctx, owner)
+		if err != nil {
+			return err
+		}
+		if !acquired {
+			logrus.WithField("lease_seconds", runLockLeaseSeconds).Warn("Another run holds the run lock, skipping this invocation")
+			return nil
+		}
+		logrus.WithField("owner", owner).Debug("Run lock acquired")
+		// Release even when the invocation context is already cancelled
+		defer releaseRunLock(context.WithoutCancel(ctx), owner)
+	}
+
 	// Get current date for storing
-	currentDate := time.Now().Format("2006-01-02")
-	logrus.WithField("date", currentDate).Debug("Processing date set")
+	currentDate := todayDate()
+	logrus.WithFields(logrus.Fields{
+		"date":     currentDate,
+		"timezone": dateLocation.String(),
+	}).Debug("Processing date set")
 
 	// Store supported currencies configuration
-	if err := storeSupportedCurrencies(); err != nil {
+	if err := storeSupportedCurrencies(ctx); err != nil {
 		logrus.WithError(err).Error("Failed to store supported currencies configuration")
 		// Log error but continue with processing - this is not critical
 	} else {
 		logrus.Info("Successfully stored supported currencies configuration")
 	}
 
-	successCount := 0
-	errorCount := 0
-	skippedCount := 0
+	stats := NewRunStats()
+	ordered, cursorStart := supportedCurrencies, 0
+	if runCursorEnabled {
+		ordered, cursorStart = rotateByRunCursor(ctx, supportedCurrencies)
+	}
+	currencies := prioritizeCurrencies(ordered)
+	if hybridStorage {
+		currencies = hybridCurrencyOrder(currencies)
+	}
+
+	// The provider call budget applies per invocation
+	providerCallsThisRun.Store(0)
+
+	// Look up today's records for all currencies upfront; on failure fall back to per-currency reads
+	prefetched, err := batchCheckExistingExchangeRates(ctx, currencies, currentDate)
+	if err != nil {
+		logrus.WithError(err).Warn("Failed to batch check existing exchange rates, checking each currency individually")
+		prefetched = nil
+	} else {
+		logrus.WithField("existing_count", len(prefetched)).Debug("Existing exchange rates prefetched")
+	}
 
 	// Process each supported currency
-	for i, baseCurrency := range supportedCurrencies {
-		logger := logrus.WithFields(logrus.Fields{
-			"currency":       baseCurrency,
+	run := &currencyRun{id: invocationID(ctx), date: currentDate, stats: stats, prefetched: prefetched}
+	var failed []string
+	for i, baseCurrency := range currencies {
+		logger := currencyLogger(baseCurrency).WithFields(logrus.Fields{
 			"currency_index": i + 1,
-			"total_count":    len(supportedCurrencies),
+			"total_count":    len(currencies),
+			"priority":       priorityCurrencies[baseCurrency],
 		})
+		if processCurrency(ctx, logger, run, baseCurrency) {
+			failed = append(failed, baseCurrency)
+		}
+	}
 
-		logger.Info("Processing exchange rates for currency")
+	if secondPassEnabled && len(failed) > 0 {
+		retryFailedCurrencies(ctx, run, failed)
+	}
+	publishFailures(ctx, run.failures)
 
-		// First, check if data already exists for this currency and date
-		existingRecord, err := checkExistingExchangeRates(baseCurrency, currentDate)
-		if err != nil {
-			logger.WithError(err).Error("Failed to check existing exchange rates")
-			errorCount++
-			continue
+	// Currencies that can never be fetched do not make a run incomplete
+	excluded := maps.Clone(providerUnsupported)
+	maps.Copy(excluded, knownUnsupportedCurrencies)
+	completeness := stats.Completeness(supportedCurrencies, excluded)
+	summary := logrus.Fields{"completeness_percent": completeness}
+	errorDigest := stats.ErrorDigest()
+	if len(errorDigest) > 0 {
+		summary["error_digest"] = errorDigest
+	}
+	if runCursorEnabled && len(supportedCurrencies) > 0 {
+		summary["cursor_start"] = supportedCurrencies[cursorStart]
+		if nextIndex := nextCursorIndex(supportedCurrencies, currencies, stats); nextIndex >= 0 {
+			summary["cursor_next"] = supportedCurrencies[nextIndex]
+			if err := storeRunCursor(ctx, supportedCurrencies, nextIndex); err != nil {
+				logrus.WithError(err).Error("Failed to store run cursor")
+			}
 		}
-
-		if existingRecord != nil {
-			logger.WithFields(logrus.Fields{
-				"existing_rates_count": len(existingRecord.ExchangeRates),
-				"updated_at":           existingRecord.UpdatedAt.Format(time.RFC3339),
-			}).Info("Exchange rates already exist for this currency and date, skipping API call")
-			skippedCount++
-			continue
+	}
+	if len(derivedCurrencies) > 0 {
+		skipped, err := storeDerivedCurrencies(ctx, currentDate)
+		if err != nil {
+			logrus.WithError(err).Error("Failed to store derived currencies")
+		} else {
+			summary["derived_skipped"] = skipped
 		}
-
-		logger.Info("No existing data found, fetching from API")
-
-		// Fetch exchange rates from API
-		rates, err := fetchExchangeRates(baseCurrency)
+	}
+	if len(requiredPairs) > 0 {
+		unresolved, err := storeRequiredPairs(ctx, currentDate)
 		if err != nil {
-			logger.WithError(err).Error("Failed to fetch exchange rates")
-			errorCount++
-			continue // Continue with next currency instead of failing completely
+			logrus.WithError(err).Error("Failed to store required pairs")
+		} else {
+			summary["unresolved_pairs"] = unresolved
 		}
-
-		logger.WithField("rates_count", len(rates.ConversionRates)).Debug("Exchange rates fetched successfully")
-
-		// Store rates in DynamoDB
-		err = storeExchangeRates(baseCurrency, currentDate, rates)
+	}
+	if validationSweep {
+		missing, err := findMissingCurrencies(ctx, currentDate)
 		if err != nil {
-			logger.WithError(err).Error("Failed to store exchange rates")
-			errorCount++
-			continue
+			logrus.WithError(err).Error("Validation sweep failed")
+		} else {
+			summary["missing"] = missing
+			if len(missing) > 0 {
+				fields := logrus.Fields{"missing": missing, "date": currentDate}
+				if validationSweepAlert {
+					// Matched by a CloudWatch log metric filter so operators can alarm on gaps
+					fields["metric"] = "CurrenciesMissing"
+				}
+				logrus.WithFields(fields).Error("Validation sweep found currencies without a record for today")
+			}
 		}
-
-		logger.WithField("rates_count", len(rates.ConversionRates)).Info("Successfully updated exchange rates for currency")
-		successCount++
 	}
 
 	duration := time.Since(startTime)
-	logrus.WithFields(logrus.Fields{
+	logrus.WithFields(stats.Fields()).WithFields(summary).WithFields(logrus.Fields{
+		"build_version":    buildVersion,
 		"total_currencies": len(supportedCurrencies),
-		"success_count":    successCount,
-		"error_count":      errorCount,
-		"skipped_count":    skippedCount,
+		"provider_calls":   providerCallsThisRun.Load(),
 		"duration_ms":      duration.Milliseconds(),
 	}).Info("Exchange rate update completed")
 
-	if errorCount > 0 && successCount == 0 && skippedCount == 0 {
-		return fmt.Errorf("all currency updates failed: %d errors", errorCount)
+	if noOpRunSignal && stats.AllSkipped() {
+		// Matched by a CloudWatch log metric filter, so consumers can tell an idle but healthy
+		// schedule from one that stopped firing
+		logrus.WithFields(logrus.Fields{
+			"metric":        "NoOpRun",
+			"date":          currentDate,
+			"skipped_count": stats.Count(outcomeSkipped),
+		}).Info("All exchange rates were already current, nothing was written")
+		emitMetrics(map[string]interface{}{"BuildVersion": buildVersion}, Metric{Name: "NoOpRun", Unit: "Count", Value: 1})
+	}
+
+	emitMetrics(map[string]interface{}{"BuildVersion": buildVersion},
+		Metric{Name: "SuccessCount", Unit: "Count", Value: float64(stats.Count(outcomeSuccess))},
+		Metric{Name: "ErrorCount", Unit: "Count", Value: float64(stats.Count(outcomeError))},
+		Metric{Name: "SkippedCount", Unit: "Count", Value: float64(stats.Count(outcomeSkipped))},
+		Metric{Name: "DegradedCount", Unit: "Count", Value: float64(stats.Count(outcomeDegraded))},
+		Metric{Name: "DeadLetteredCount", Unit: "Count", Value: float64(stats.Count(outcomeDeadLettered))},
+		Metric{Name: "SkippedBudgetCount", Unit: "Count", Value: float64(stats.Count(outcomeSkippedBudget))},
+		Metric{Name: "UnsupportedCount", Unit: "Count", Value: float64(stats.Count(outcomeUnsupported))},
+		Metric{Name: "ProviderCalls", Unit: "Count", Value: float64(providerCallsThisRun.Load())},
+		Metric{Name: "RunDuration", Unit: "Milliseconds", Value: float64(duration.Milliseconds())},
+		Metric{Name: "Completeness", Unit: "Percent", Value: completeness},
+	)
+
+	if reportEnabled() {
+		if err := publishRateReport(ctx, currentDate); err != nil {
+			// The report is a convenience, a failed upload does not fail the run
+			logrus.WithError(err).Error("Failed to publish rate report")
+		}
+	}
+
+	if err := storeRunStatus(ctx, currentDate, startTime, stats, errorDigest); err != nil {
+		logrus.WithError(err).Error("Failed to store run status")
+	}
+
+	if runOutcome(stats) == runOutcomeFailed {
+		return fmt.Errorf("all currency updates failed: %d errors", stats.Count(outcomeError))
 	}
 
 	return nil
 }
 
-func fetchExchangeRates(baseCurrency string) (*ExchangeRateResponse, error) {
-	// Validate baseCurrency
-	if len(baseCurrency) != 3 {
-		return nil, fmt.Errorf("baseCurrency must be 3 characters")
+// currencyRun holds the state shared by the currencies processed in one invocation.
+type currencyRun struct {
+	id           string
+	date         string
+	stats        *RunStats
+	prefetched   map[string]*ExchangeRateRecord
+	budgetLogged bool
+	secondPass   bool
+	failures     []FailureMessage
+}
+
+// processCurrency checks, fetches and stores the rates of one currency for the run's date and
+// records its outcome. It returns true when an error outcome was recorded.
+func processCurrency(ctx context.Context, logger *logrus.Entry, run *currencyRun, baseCurrency string) bool {
+	if knownUnsupportedCurrencies[baseCurrency] {
+		logger.Debug("Currency is known to be unsupported by the provider, skipping")
+		run.stats.Record(ctx, baseCurrency, outcomeUnsupported)
+		return false
 	}
-	for _, r := range baseCurrency {
-		if r < 'A' || r > 'Z' {
-			return nil, fmt.Errorf("baseCurrency must be uppercase letters")
+
+	logger.Info("Processing exchange rates for currency")
+
+	if deadLetterEnabled() && deadLetterSkip {
+		deadLettered, err := isDeadLettered(ctx, baseCurrency)
+		if err != nil {
+			logger.WithError(err).Error("Failed to check dead-letter record")
+		} else if deadLettered {
+			logger.Warn("Currency is dead-lettered, skipping until manually reset")
+			run.stats.Record(ctx, baseCurrency, outcomeDeadLettered)
+			return false
 		}
 	}
 
-	var url string
-	if apiKey != "" {
-		url = fmt.Sprintf("https://v6.exchangerate-api.com/v6/%s/latest/%s", apiKey, baseCurrency)
+	// First, check if data already exists for this currency and date. Each phase's duration
+	// is attached to the logger so later lines show where the time went
+	phaseStart := time.Now()
+	var existingRecord *ExchangeRateRecord
+	var err error
+	if run.prefetched != nil {
+		existingRecord = run.prefetched[baseCurrency]
 	} else {
-		url = fmt.Sprintf("https://api.exchangerate-api.com/v4/latest/%s", baseCurrency)
+		existingRecord, err = checkExistingExchangeRates(ctx, baseCurrency, run.date)
+	}
+	logger = logger.WithField("check_ms", time.Since(phaseStart).Milliseconds())
+	if err != nil {
+		logger.WithError(err).Error("Failed to check existing exchange rates")
+		run.stats.Record(ctx, baseCurrency, outcomeError)
+		run.stats.RecordError(baseCurrency, failureStageCheck, err)
+		run.queueFailure(baseCurrency, failureStageCheck, err)
+		return true
 	}
 
-	resp, err := http.Get(url)
+	if existingRecord != nil && existingRecord.Degraded {
+		logger.WithField("source_date", existingRecord.SourceDate).Info("Existing exchange rates are degraded, fetching from API again")
+	} else if existingRecord != nil {
+		logger.WithFields(logrus.Fields{
+			"existing_rates_count": len(existingRecord.ExchangeRates),
+			"updated_at":           existingRecord.UpdatedAt.Format(time.RFC3339),
+		}).Info("Exchange rates already exist for this currency and date, skipping API call")
+		run.stats.Record(ctx, baseCurrency, outcomeSkipped)
+		return false
+	}
+
+	if hybridStorage && baseCurrency != hybridBase {
+		// Views reference the hybrid base stored earlier in this run instead of being fetched
+		if err := storeExchangeRateView(ctx, logger, baseCurrency, run.date); err != nil {
+			logger.WithError(err).Error("Failed to store exchange rate view")
+			run.stats.Record(ctx, baseCurrency, outcomeError)
+			run.stats.RecordError(baseCurrency, failureStageStore, err)
+			run.queueFailure(baseCurrency, failureStageStore, err)
+			return true
+		}
+		logger.WithField("view_of", hybridBase).Info("Stored exchange rate view for currency")
+		run.stats.Record(ctx, baseCurrency, outcomeSuccess)
+		return false
+	}
+
+	logger.Info("No existing data found, fetching from API")
+
+	// Fetch exchange rates from API
+	phaseStart = time.Now()
+	rates, err := fetchExchangeRates(ctx, logger, baseCurrency)
+	fetchElapsed := time.Since(phaseStart)
+	logger = logger.WithField("fetch_ms", fetchElapsed.Milliseconds())
+	emitMetrics(map[string]interface{}{"Currency": baseCurrency, "FetchSucceeded": err == nil},
+		Metric{Name: "FetchLatency", Unit: "Milliseconds", Value: float64(fetchElapsed.Microseconds()) / 1000})
+	if err == nil {
+		err = checkRateCountDrop(ctx, logger, baseCurrency, run.date, rates)
+	}
+	if err == nil {
+		err = checkRateBounds(logger, baseCurrency, rates)
+	}
+	if errors.Is(err, errProviderBudgetExhausted) {
+		if !run.budgetLogged {
+			logger.WithFields(logrus.Fields{
+				"max_provider_calls": maxProviderCallsPerRun,
+				"provider_calls":     providerCallsThisRun.Load(),
+			}).Warn("Provider call budget reached, skipping remaining fetches")
+			run.budgetLogged = true
+		}
+		run.stats.Record(ctx, baseCurrency, outcomeSkippedBudget)
+		if useLastKnownGood {
+			keepLastKnownGood(ctx, logger, run.stats, baseCurrency, run.date, existingRecord)
+		}
+		return false
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch exchange rates: %w", err)
+		logger.WithError(err).Error("Failed to fetch exchange rates")
+		run.stats.Record(ctx, baseCurrency, outcomeError)
+		run.stats.RecordError(baseCurrency, failureStageFetch, err)
+		run.queueFailure(baseCurrency, failureStageFetch, err)
+		// A currency retried in the second pass already counted one failure for this run
+		if deadLetterEnabled() && !run.secondPass {
+			recordCurrencyFailure(ctx, logger, baseCurrency, err)
+		}
+		if useLastKnownGood {
+			keepLastKnownGood(ctx, logger, run.stats, baseCurrency, run.date, existingRecord)
+		}
+		return true // Continue with next currency instead of failing completely
+	}
+
+	logger.WithField("rates_count", len(rates.ConversionRates)).Debug("Exchange rates fetched successfully")
+
+	normalizeSelfRate(logger, baseCurrency, rates)
+	filterPeggedRates(logger, baseCurrency, rates)
+	roundRates(rates)
+
+	// Store rates in DynamoDB
+	phaseStart = time.Now()
+	err = storeExchangeRates(ctx, logger, baseCurrency, run.date, rates)
+	logger = logger.WithField("store_ms", time.Since(phaseStart).Milliseconds())
+	var conflictErr *WriteConflictError
+	if errors.As(err, &conflictErr) {
+		// Another region already stored today's rates, which is not a failure of this one
+		run.stats.Record(ctx, baseCurrency, outcomeSkipped)
+		return false
+	}
+	if err != nil {
+		logger.WithError(err).Error("Failed to store exchange rates")
+		run.stats.Record(ctx, baseCurrency, outcomeError)
+		run.stats.RecordError(baseCurrency, failureStageStore, err)
+		run.queueFailure(baseCurrency, failureStageStore, err)
+		if deadLetterEnabled() && !run.secondPass {
+			recordCurrencyFailure(ctx, logger, baseCurrency, err)
+		}
+		return true
+	}
+
+	logger.WithField("rates_count", len(rates.ConversionRates)).Info("Successfully updated exchange rates for currency")
+	run.stats.Record(ctx, baseCurrency, outcomeSuccess)
+	if deadLetterEnabled() {
+		resetCurrencyFailures(ctx, logger, baseCurrency)
 	}
-	defer resp.Body.Close()
+	return false
+}
+
+// retryFailedCurrencies gives the currencies that failed in the first pass one more attempt
+// after SECOND_PASS_DELAY_MS, since transient provider blips often clear within seconds.
+// Currencies are only started while SECOND_PASS_BUDGET_SECONDS allows; the rest keep their
+// first pass outcome. A retried currency's first pass outcomes are replaced by the new ones.
+func retryFailedCurrencies(ctx context.Context, run *currencyRun, failed []string) {
+	delay := time.Duration(secondPassDelayMs) * time.Millisecond
+	budget := time.Duration(secondPassBudgetSeconds) * time.Second
+	passLogger := logrus.WithFields(logrus.Fields{
+		"failed":         failed,
+		"delay_ms":       delay.Milliseconds(),
+		"budget_seconds": secondPassBudgetSeconds,
+	})
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API returned status %d", resp.StatusCode)
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= delay {
+		passLogger.WithField("remaining_ms", time.Until(deadline).Milliseconds()).Warn("Not enough time left for a second pass, skipping it")
+		return
 	}
+	passLogger.Info("Retrying failed currencies in a second pass")
 
-	var exchangeRates ExchangeRateResponse
-	if err := json.NewDecoder(resp.Body).Decode(&exchangeRates); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(delay):
 	}
 
-	// Check if the API call was successful (for the paid API version)
-	if exchangeRates.Result != "" && exchangeRates.Result != "success" {
-		return nil, fmt.Errorf("API call failed with result: %s", exchangeRates.Result)
+	// The first pass prefetch is stale by now, so every currency is checked again
+	run.prefetched = nil
+	run.secondPass = true
+
+	passStart := time.Now()
+	var recovered, stillFailed, notRetried []string
+	for i, baseCurrency := range failed {
+		if time.Since(passStart) >= budget || ctx.Err() != nil {
+			notRetried = failed[i:]
+			break
+		}
+
+		run.stats.Forget(baseCurrency)
+		run.dropFailures(baseCurrency)
+		logger := currencyLogger(baseCurrency).WithField("second_pass", true)
+		if processCurrency(ctx, logger, run, baseCurrency) {
+			stillFailed = append(stillFailed, baseCurrency)
+		} else {
+			recovered = append(recovered, baseCurrency)
+		}
 	}
 
-	return &exchangeRates, nil
+	logrus.WithFields(logrus.Fields{
+		"recovered":    recovered,
+		"still_failed": stillFailed,
+		"not_retried":  notRetried,
+		"duration_ms":  time.Since(passStart).Milliseconds(),
+	}).Info("Second pass completed")
 }
 
-func checkExistingExchangeRates(baseCurrency, date string) (*ExchangeRateRecord, error) {
+func checkExistingExchangeRates(ctx context.Context, baseCurrency, date string) (record *ExchangeRateRecord, err error) {
+	ctx, endSpan := startSpan(ctx, "dynamodb.GetItem", dynamoOpDuration,
+		attribute.String("currency", baseCurrency), attribute.String("operation", "GetItem"))
+	defer func() { endSpan(err) }()
+
 	key := map[string]interface{}{
-		"Key":     date,
+		"Key":     prefixedKey(date),
 		"SortKey": baseCurrency,
 	}
 
@@ -256,7 +1261,7 @@ func checkExistingExchangeRates(baseCurrency, date string) (*ExchangeRateRecord,
 		return nil, fmt.Errorf("error marshaling key for %s: %w", baseCurrency, err)
 	}
 
-	result, err := dynamoClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
+	result, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
 		TableName: aws.String(tableName),
 		Key:       keyItem,
 	})
@@ -270,25 +1275,105 @@ func checkExistingExchangeRates(baseCurrency, date string) (*ExchangeRateRecord,
 		return nil, nil
 	}
 
-	var record ExchangeRateRecord
-	err = attributevalue.UnmarshalMap(result.Item, &record)
+	var existing ExchangeRateRecord
+	err = attributevalue.UnmarshalMap(result.Item, &existing)
 	if err != nil {
 		return nil, fmt.Errorf("error unmarshaling existing record for %s: %w", baseCurrency, err)
 	}
+	existing.Key = unprefixedKey(existing.Key)
+
+	return &existing, nil
+}
+
+// batchCheckExistingExchangeRates reads the records of all currencies for date with BatchGetItem
+// and returns the ones that exist keyed by currency. Requests are sent in chunks of
+// batchGetChunkSize and unprocessed keys are retried with backoff.
+func batchCheckExistingExchangeRates(ctx context.Context, currencies []string, date string) (existing map[string]*ExchangeRateRecord, err error) {
+	ctx, endSpan := startSpan(ctx, "dynamodb.BatchGetItem", dynamoOpDuration,
+		attribute.Int("currencies", len(currencies)), attribute.String("operation", "BatchGetItem"))
+	defer func() { endSpan(err) }()
+
+	existing = make(map[string]*ExchangeRateRecord, len(currencies))
+	for start := 0; start < len(currencies); start += batchGetChunkSize {
+		end := min(start+batchGetChunkSize, len(currencies))
+
+		keys := make([]map[string]types.AttributeValue, 0, end-start)
+		for _, baseCurrency := range currencies[start:end] {
+			keyItem, err := attributevalue.MarshalMap(map[string]interface{}{
+				"Key":     prefixedKey(date),
+				"SortKey": baseCurrency,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("error marshaling key for %s: %w", baseCurrency, err)
+			}
+			keys = append(keys, keyItem)
+		}
+
+		request := map[string]types.KeysAndAttributes{tableName: {Keys: keys}}
+		for attempt := 0; len(request) > 0; attempt++ {
+			if attempt > batchGetMaxRetries {
+				return nil, fmt.Errorf("unprocessed keys remain after %d batch get retries", batchGetMaxRetries)
+			}
+			if attempt > 0 {
+				select {
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				case <-time.After(time.Duration(50<<attempt) * time.Millisecond):
+				}
+			}
+
+			result, err := dynamoClient.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{RequestItems: request})
+			if err != nil {
+				return nil, fmt.Errorf("error batch checking existing rates on %s: %w", date, err)
+			}
+
+			for _, item := range result.Responses[tableName] {
+				var record ExchangeRateRecord
+				if err := attributevalue.UnmarshalMap(item, &record); err != nil {
+					return nil, fmt.Errorf("error unmarshaling existing record: %w", err)
+				}
+				record.Key = unprefixedKey(record.Key)
+				existing[record.SortKey] = &record
+			}
+
+			request = result.UnprocessedKeys
+		}
+	}
 
-	return &record, nil
+	return existing, nil
 }
 
-func storeExchangeRates(baseCurrency, date string, rates *ExchangeRateResponse) error {
+func storeExchangeRates(ctx context.Context, logger *logrus.Entry, baseCurrency, date string, rates *ExchangeRateResponse) (err error) {
+	ctx, endSpan := startSpan(ctx, "dynamodb.PutItem", dynamoOpDuration,
+		attribute.String("currency", baseCurrency), attribute.String("operation", "PutItem"))
+	defer func() { endSpan(err) }()
+
+	// Never replace a stored record, possibly a good one, with an empty rate map
+	if len(rates.ConversionRates) == 0 {
+		return fmt.Errorf("refusing to store empty exchange rates for %s on %s", baseCurrency, date)
+	}
+
 	// Calculate expiration time: current time + TTL interval in days
 	expiresAt := time.Now().AddDate(0, 0, ttlIntervalDays).Unix()
 
 	record := ExchangeRateRecord{
-		Key:           date,
-		SortKey:       baseCurrency,
-		ExchangeRates: rates.ConversionRates,
-		UpdatedAt:     time.Now(),
-		ExpiresAt:     expiresAt,
+		Key:              prefixedKey(date),
+		SortKey:          baseCurrency,
+		ExchangeRates:    rates.ConversionRates,
+		UpdatedAt:        time.Now(),
+		ExpiresAt:        expiresAt,
+		SchemaVersion:    exchangeRateSchemaVersion,
+		WrittenByVersion: buildVersion,
+		Suspect:          rates.Suspect,
+		RateTimestamp:    rates.RateTimestamp,
+		Source:           writeSource,
+	}
+
+	if captureSpreads {
+		record.Spreads = extractSpreads(rates)
+	}
+	if storeFetchMeta {
+		record.FetchMeta = rates.FetchMeta
 	}
 
 	item, err := attributevalue.MarshalMap(record)
@@ -296,31 +1381,243 @@ func storeExchangeRates(baseCurrency, date string, rates *ExchangeRateResponse)
 		return fmt.Errorf("error marshaling record for %s: %w", baseCurrency, err)
 	}
 
-	_, err = dynamoClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
-		TableName: aws.String(tableName),
-		Item:      item,
-	})
-	if err != nil {
-		return fmt.Errorf("error storing rates for %s: %w", baseCurrency, err)
+	if writeConflictPolicy == writeConflictReject {
+		if err := putExchangeRatesExclusive(ctx, logger, baseCurrency, date, item); err != nil {
+			return err
+		}
+	} else {
+		if writeConflictPolicy == writeConflictLog {
+			logWriteConflict(ctx, logger, baseCurrency, date)
+		}
+		_, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(tableName),
+			Item:      item,
+		})
+		if err != nil {
+			return fmt.Errorf("error storing rates for %s: %w", baseCurrency, err)
+		}
 	}
 
-	logrus.WithFields(logrus.Fields{
-		"currency":    baseCurrency,
+	logger.WithFields(logrus.Fields{
 		"date":        date,
 		"rates_count": len(rates.ConversionRates),
 		"table":       tableName,
 		"expires_at":  time.Unix(record.ExpiresAt, 0).Format(time.RFC3339),
 		"ttl_days":    ttlIntervalDays,
+		"spreads":     len(record.Spreads),
 	}).Debug("Successfully stored exchange rates to DynamoDB")
 	return nil
 }
 
-func storeSupportedCurrencies() error {
+// extractSpreads collects bid/ask pairs for targets where the provider supplied both.
+// It returns nil when no spreads are available so the attribute is omitted from the record.
+func extractSpreads(rates *ExchangeRateResponse) map[string]RateSpread {
+	if len(rates.BidRates) == 0 || len(rates.AskRates) == 0 {
+		return nil
+	}
+
+	spreads := make(map[string]RateSpread)
+	for target, bid := range rates.BidRates {
+		ask, ok := rates.AskRates[target]
+		if !ok {
+			continue
+		}
+		spreads[target] = RateSpread{Bid: bid, Ask: ask}
+	}
+
+	if len(spreads) == 0 {
+		return nil
+	}
+	return spreads
+}
+
+// checkRateCountDrop compares the number of fetched targets with the previous day's record.
+// When the count fell by more than RATE_COUNT_DROP_PERCENT the response is treated as suspect:
+// the "skip" policy rejects it like a failed fetch, the "flag" policy stores it marked Suspect.
+func checkRateCountDrop(ctx context.Context, logger *logrus.Entry, baseCurrency, date string, rates *ExchangeRateResponse) error {
+	if rateDropPercent <= 0 {
+		return nil
+	}
+
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return fmt.Errorf("invalid date %s: %w", date, err)
+	}
+	previousDate := day.AddDate(0, 0, -1).Format("2006-01-02")
+
+	previous, err := checkExistingExchangeRates(ctx, baseCurrency, previousDate)
+	if err != nil {
+		// Not being able to compare should not block storing fresh rates
+		logger.WithError(err).Warn("Failed to read previous day's exchange rates for rate count check")
+		return nil
+	}
+	if previous == nil || len(previous.ExchangeRates) == 0 {
+		return nil
+	}
+
+	previousCount := len(previous.ExchangeRates)
+	currentCount := len(rates.ConversionRates)
+	dropPercent := float64(previousCount-currentCount) * 100 / float64(previousCount)
+	if dropPercent <= float64(rateDropPercent) {
+		return nil
+	}
+
+	fields := logrus.Fields{
+		"previous_date":  previousDate,
+		"previous_count": previousCount,
+		"current_count":  currentCount,
+		"drop_percent":   dropPercent,
+		"policy":         rateDropPolicy,
+	}
+	if rateDropPolicy == "flag" {
+		logger.WithFields(fields).Warn("Rate count dropped sharply, storing response flagged as suspect")
+		rates.Suspect = true
+		return nil
+	}
+
+	logger.WithFields(fields).Warn("Rate count dropped sharply, rejecting response")
+	return fmt.Errorf("suspect response: %d targets vs %d on %s", currentCount, previousCount, previousDate)
+}
+
+// storeLastKnownGood carries the last known good rates forward after the currency could not be
+// fetched and records the degraded outcome when an earlier record was found.
+func storeLastKnownGood(ctx context.Context, logger *logrus.Entry, stats *RunStats, baseCurrency, date string) {
+	degraded, err := carryForwardLastKnownGood(ctx, baseCurrency, date)
+	if err != nil {
+		logger.WithError(err).Error("Failed to carry forward last known good exchange rates")
+	} else if degraded != nil {
+		logger.WithFields(logrus.Fields{
+			"source_date": degraded.SourceDate,
+			"rates_count": len(degraded.ExchangeRates),
+		}).Warn("Fetch failed, stored last known good exchange rates as degraded data")
+		stats.Record(ctx, baseCurrency, outcomeDegraded)
+	} else {
+		logger.WithField("lookback_days", lastKnownGoodDays).Warn("Fetch failed and no last known good exchange rates found")
+	}
+}
+
+// keepLastKnownGood makes sure baseCurrency has degraded data for date after a fetch that did
+// not succeed. A record that is already degraded, e.g. carried forward by the first pass before
+// the second pass retried the currency, is left as it is and counted as degraded again.
+func keepLastKnownGood(ctx context.Context, logger *logrus.Entry, stats *RunStats, baseCurrency, date string, existing *ExchangeRateRecord) {
+	if existing != nil && existing.Degraded {
+		logger.WithField("source_date", existing.SourceDate).Warn("Fetch failed, keeping the degraded exchange rates already stored")
+		stats.Record(ctx, baseCurrency, outcomeDegraded)
+		return
+	}
+	storeLastKnownGood(ctx, logger, stats, baseCurrency, date)
+}
+
+// findMissingCurrencies lists, in configured order, the supported currencies that have no
+// record for date after the run. Known unsupported currencies are never expected to have one.
+func findMissingCurrencies(ctx context.Context, date string) ([]string, error) {
+	existing, err := batchCheckExistingExchangeRates(ctx, supportedCurrencies, date)
+	if err != nil {
+		return nil, err
+	}
+
+	missing := []string{}
+	for _, baseCurrency := range supportedCurrencies {
+		if existing[baseCurrency] == nil && !knownUnsupportedCurrencies[baseCurrency] {
+			missing = append(missing, baseCurrency)
+		}
+	}
+	return missing, nil
+}
+
+// carryForwardLastKnownGood copies the most recent record stored before date forward under
+// date, flagged as degraded. It looks back at most lastKnownGoodDays and returns nil when
+// no earlier record was found.
+func carryForwardLastKnownGood(ctx context.Context, baseCurrency, date string) (*ExchangeRateRecord, error) {
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date %s: %w", date, err)
+	}
+
+	for i := 1; i <= lastKnownGoodDays; i++ {
+		priorDate := day.AddDate(0, 0, -i).Format("2006-01-02")
+		prior, err := checkExistingExchangeRates(ctx, baseCurrency, priorDate)
+		if err != nil {
+			return nil, err
+		}
+		if prior == nil {
+			continue
+		}
+
+		// Keep pointing at the original day when the prior record is itself a carry-forward
+		sourceDate := priorDate
+		if prior.Degraded && prior.SourceDate != "" {
+			sourceDate = prior.SourceDate
+		}
+
+		record := ExchangeRateRecord{
+			Key:              prefixedKey(date),
+			SortKey:          baseCurrency,
+			ExchangeRates:    prior.ExchangeRates,
+			Spreads:          prior.Spreads,
+			Degraded:         true,
+			SourceDate:       sourceDate,
+			RateTimestamp:    prior.RateTimestamp,
+			UpdatedAt:        time.Now(),
+			ExpiresAt:        time.Now().AddDate(0, 0, ttlIntervalDays).Unix(),
+			SchemaVersion:    exchangeRateSchemaVersion,
+			WrittenByVersion: buildVersion,
+		}
+
+		item, err := attributevalue.MarshalMap(record)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling degraded record for %s: %w", baseCurrency, err)
+		}
+
+		_, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(tableName),
+			Item:      item,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error storing degraded rates for %s: %w", baseCurrency, err)
+		}
+
+		record.Key = date
+		return &record, nil
+	}
+
+	return nil, nil
+}
+
+// prioritizeCurrencies returns the currencies with the PRIORITY_CURRENCIES tier first, keeping
+// the configured order within each tier, so critical currencies are covered before the rest.
+func prioritizeCurrencies(currencies []string) []string {
+	if len(priorityCurrencies) == 0 {
+		return currencies
+	}
+
+	priority := make([]string, 0, len(priorityCurrencies))
+	rest := make([]string, 0, len(currencies))
+	for _, currency := range currencies {
+		if priorityCurrencies[currency] {
+			priority = append(priority, currency)
+		} else {
+			rest = append(rest, currency)
+		}
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"priority_currencies": priority,
+		"priority_count":      len(priority),
+		"remaining_count":     len(rest),
+	}).Info("Processing priority currencies first")
+
+	return append(priority, rest...)
+}
+
+func storeSupportedCurrencies(ctx context.Context) error {
 	record := SupportedCurrenciesRecord{
-		Key:                 "SupportedCurrencies",
+		Key:                 prefixedKey(supportedCurrenciesKey),
 		SortKey:             "-",
 		SupportedCurrencies: supportedCurrencies,
 		UpdatedAt:           time.Now(),
+		SchemaVersion:       supportedCurrenciesSchemaVersion,
+		WrittenByVersion:    buildVersion,
 	}
 
 	item, err := attributevalue.MarshalMap(record)
@@ -328,7 +1625,7 @@ func storeSupportedCurrencies() error {
 		return fmt.Errorf("error marshaling supported currencies record: %w", err)
 	}
 
-	_, err = dynamoClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
+	_, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
 		TableName: aws.String(tableName),
 		Item:      item,
 	})
@@ -345,5 +1642,12 @@ func storeSupportedCurrencies() error {
 }
 
 func main() {
+	setup()
+
+	// The same binary backs both the scheduled cooker and the read API
+	if handlerMode == "api" {
+		lambda.Start(apiHandler)
+		return
+	}
 	lambda.Start(handler)
 }
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestTodayDateAcrossDSTTransitions(t *testing.T) {
+	previousLocation, previousClock := dateLocation, clock
+	t.Cleanup(func() { dateLocation, clock = previousLocation, previousClock })
+	location, err := loadDateLocation("Europe/Madrid")
+	if err != nil {
+		t.Fatalf("loadDateLocation() error = %v", err)
+	}
+	dateLocation = location
+
+	tests := []struct {
+		name string
+		now  string
+		want string
+	}{
+		// Spring forward on 2024-03-31: 02:00 CET jumps to 03:00 CEST at 01:00 UTC
+		{"last second before spring-forward day", "2024-03-30T22:59:59Z", "2024-03-30"},
+		{"local midnight of spring-forward day", "2024-03-30T23:00:00Z", "2024-03-31"},
+		{"just before the jump", "2024-03-31T00:59:59Z", "2024-03-31"},
+		{"just after the jump", "2024-03-31T01:00:00Z", "2024-03-31"},
+		{"last second of spring-forward day", "2024-03-31T21:59:59Z", "2024-03-31"},
+		{"local midnight after spring-forward day", "2024-03-31T22:00:00Z", "2024-04-01"},
+
+		// Fall back on 2024-10-27: 03:00 CEST returns to 02:00 CET at 01:00 UTC
+		{"last second before fall-back day", "2024-10-26T21:59:59Z", "2024-10-26"},
+		{"local midnight of fall-back day", "2024-10-26T22:00:00Z", "2024-10-27"},
+		{"first 02:30 of fall-back day", "2024-10-27T00:30:00Z", "2024-10-27"},
+		{"repeated 02:30 of fall-back day", "2024-10-27T01:30:00Z", "2024-10-27"},
+		{"last second of fall-back day", "2024-10-27T22:59:59Z", "2024-10-27"},
+		{"local midnight after fall-back day", "2024-10-27T23:00:00Z", "2024-10-28"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instant, err := time.Parse(time.RFC3339, tt.now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			clock = func() time.Time { return instant }
+
+			if got := todayDate(); got != tt.want {
+				t.Errorf("todayDate() at %s = %s, want %s", tt.now, got, tt.want)
+			}
+		})
+	}
+}
+
+// failingTransport fails every request before it reaches the network.
+type failingTransport struct{}
+
+func (failingTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestSecondPassKeepsDegradedOutcome(t *testing.T) {
+	previousClient, previousProfiles, previousKey := httpClient, providerProfiles, apiKey
+	previousLastKnownGood, previousHybrid := useLastKnownGood, hybridStorage
+	t.Cleanup(func() {
+		httpClient, providerProfiles, apiKey = previousClient, previousProfiles, previousKey
+		useLastKnownGood, hybridStorage = previousLastKnownGood, previousHybrid
+	})
+
+	profile := defaultProviderProfile()
+	profile.MaxRetries = 0
+	httpClient = &http.Client{Transport: failingTransport{}}
+	providerProfiles = map[string]ProviderProfile{providerExchangeRateAPIv4: profile}
+	apiKey = ""
+	useLastKnownGood, hybridStorage = true, false
+	setupTelemetry(context.Background())
+
+	// The first pass carried forward yesterday's rates before the second pass retried EUR
+	run := &currencyRun{
+		date:       "2024-05-02",
+		stats:      NewRunStats(),
+		secondPass: true,
+		prefetched: map[string]*ExchangeRateRecord{
+			"EUR": {Key: "2024-05-02", SortKey: "EUR", ExchangeRates: map[string]float64{"USD": 1.07}, Degraded: true, SourceDate: "2024-05-01"},
+		},
+	}
+
+	if !processCurrency(context.Background(), logrus.NewEntry(logrus.StandardLogger()), run, "EUR") {
+		t.Error("processCurrency() = false, want true for the failed fetch")
+	}
+	if got := run.stats.Count(outcomeError); got != 1 {
+		t.Errorf("error count = %d, want 1", got)
+	}
+	if got := run.stats.Count(outcomeDegraded); got != 1 {
+		t.Errorf("degraded count = %d, want 1", got)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ProviderFieldMapping names the response fields a provider's values are read from. Each entry
+// is a dot separated path into the JSON response, e.g. "data.rates"; an empty path means the
+// provider does not send that value. Only Rates is required.
+type ProviderFieldMapping struct {
+	Result             string `json:"result"`
+	Base               string `json:"base"`
+	Rates              string `json:"rates"`
+	BidRates           string `json:"bid_rates"`
+	AskRates           string `json:"ask_rates"`
+	TimeLastUpdateUnix string `json:"time_last_update_unix"`
+	TimeLastUpdateUTC  string `json:"time_last_update_utc"`
+	TimeLastUpdated    string `json:"time_last_updated"`
+	TimeNextUpdateUnix string `json:"time_next_update_unix"`
+}
+
+// defaultProviderFieldMappings describes the responses of the built-in providers.
+func defaultProviderFieldMappings() map[string]ProviderFieldMapping {
+	return map[string]ProviderFieldMapping{
+		providerExchangeRateAPIv6: {
+			Result:             "result",
+			Base:               "base_code",
+			Rates:              "conversion_rates",
+			BidRates:           "bid_rates",
+			AskRates:           "ask_rates",
+			TimeLastUpdateUnix: "time_last_update_unix",
+			TimeLastUpdateUTC:  "time_last_update_utc",
+			TimeNextUpdateUnix: "time_next_update_unix",
+		},
+		providerExchangeRateAPIv4: {
+			Base:            "base",
+			Rates:           "rates",
+			TimeLastUpdated: "time_last_updated",
+		},
+	}
+}
+
+// loadProviderFieldMappings parses PROVIDER_FIELD_MAPPING, a JSON object keyed by provider name,
+// e.g. {"exchangerate-api-v6": {"rates": "data.rates"}}. Fields that are not set keep the
+// built-in mapping.
+func loadProviderFieldMappings(mappingJSON string) (map[string]ProviderFieldMapping, error) {
+	mappings := defaultProviderFieldMappings()
+	if mappingJSON == "" {
+		return mappings, nil
+	}
+
+	var overrides map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(mappingJSON), &overrides); err != nil {
+		return nil, fmt.Errorf("PROVIDER_FIELD_MAPPING must be a valid JSON object: %w", err)
+	}
+
+	for name, raw := range overrides {
+		mapping, ok := mappings[name]
+		if !ok {
+			return nil, fmt.Errorf("PROVIDER_FIELD_MAPPING references unknown provider %q", name)
+		}
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&mapping); err != nil {
+			return nil, fmt.Errorf("PROVIDER_FIELD_MAPPING contains an invalid mapping for %s: %w", name, err)
+		}
+		if err := mapping.validate(); err != nil {
+			return nil, fmt.Errorf("PROVIDER_FIELD_MAPPING contains an invalid mapping for %s: %w", name, err)
+		}
+		mappings[name] = mapping
+	}
+
+	return mappings, nil
+}
+
+func (m ProviderFieldMapping) validate() error {
+	if m.Rates == "" {
+		return fmt.Errorf("rates path is required")
+	}
+	for _, path := range []string{m.Result, m.Base, m.Rates, m.BidRates, m.AskRates, m.TimeLastUpdateUnix, m.TimeLastUpdateUTC, m.TimeLastUpdated, m.TimeNextUpdateUnix} {
+		if path == "" {
+			continue
+		}
+		for _, segment := range strings.Split(path, ".") {
+			if segment == "" {
+				return fmt.Errorf("path %q has an empty segment", path)
+			}
+		}
+	}
+	return nil
+}
+
+// decodeProviderResponse reads a provider response through its field mapping. Missing optional
+// fields are left empty; a present field with the wrong type fails the decode.
+func decodeProviderResponse(data []byte, mapping ProviderFieldMapping) (*ExchangeRateResponse, error) {
+	var root json.RawMessage
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+
+	var response ExchangeRateResponse
+	fields := []struct {
+		path   string
+		target interface{}
+	}{
+		{mapping.Result, &response.Result},
+		{mapping.Base, &response.BaseCode},
+		{mapping.Rates, &response.ConversionRates},
+		{mapping.BidRates, &response.BidRates},
+		{mapping.AskRates, &response.AskRates},
+		{mapping.TimeLastUpdateUnix, &response.TimeLastUpdateUnix},
+		{mapping.TimeLastUpdateUTC, &response.TimeLastUpdateUTC},
+		{mapping.TimeLastUpdated, &response.TimeLastUpdated},
+		{mapping.TimeNextUpdateUnix, &response.TimeNextUpdateUnix},
+	}
+	for _, field := range fields {
+		value, ok, err := lookupJSONPath(root, field.path)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		if err := json.Unmarshal(value, field.target); err != nil {
+			return nil, fmt.Errorf("field %s: %w", field.path, err)
+		}
+	}
+	return &response, nil
+}
+
+// lookupJSONPath follows a dot separated path of object keys from root. It reports false when
+// the path is empty or any key along it is missing or null.
+func lookupJSONPath(root json.RawMessage, path string) (json.RawMessage, bool, error) {
+	if path == "" {
+		return nil, false, nil
+	}
+
+	value := root
+	for _, segment := range strings.Split(path, ".") {
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(value, &object); err != nil {
+			return nil, false, fmt.Errorf("field %s: expected an object at %q: %w", path, segment, err)
+		}
+		next, ok := object[segment]
+		if !ok || string(next) == "null" {
+			return nil, false, nil
+		}
+		value = next
+	}
+	return value, true, nil
+}
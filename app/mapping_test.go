@@ -0,0 +1,152 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLoadProviderFieldMappings(t *testing.T) {
+	defaults := defaultProviderFieldMappings()
+	overridden := defaultProviderFieldMappings()
+	v6 := overridden[providerExchangeRateAPIv6]
+	v6.Rates = "data.rates"
+	v6.BidRates = ""
+	overridden[providerExchangeRateAPIv6] = v6
+
+	tests := []struct {
+		name    string
+		value   string
+		want    map[string]ProviderFieldMapping
+		wantErr bool
+	}{
+		{"unset keeps the built-in mappings", "", defaults, false},
+		{"override merged over the built-in mapping", `{"exchangerate-api-v6": {"rates": "data.rates", "bid_rates": ""}}`, overridden, false},
+		{"not an object", `"data.rates"`, nil, true},
+		{"unknown provider", `{"fixer": {"rates": "rates"}}`, nil, true},
+		{"unknown field", `{"exchangerate-api-v6": {"rate": "rates"}}`, nil, true},
+		{"rates cleared", `{"exchangerate-api-v6": {"rates": ""}}`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := loadProviderFieldMappings(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadProviderFieldMappings() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("loadProviderFieldMappings() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProviderFieldMappingValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapping ProviderFieldMapping
+		wantErr bool
+	}{
+		{"rates only", ProviderFieldMapping{Rates: "rates"}, false},
+		{"nested paths", ProviderFieldMapping{Rates: "data.rates", Base: "data.base"}, false},
+		{"rates missing", ProviderFieldMapping{Base: "base"}, true},
+		{"empty segment", ProviderFieldMapping{Rates: "data..rates"}, true},
+		{"trailing dot", ProviderFieldMapping{Rates: "rates", Base: "meta."}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.mapping.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDecodeProviderResponse(t *testing.T) {
+	defaults := defaultProviderFieldMappings()
+	nested := ProviderFieldMapping{Base: "meta.base", Rates: "data.rates", TimeLastUpdateUnix: "meta.updated"}
+
+	tests := []struct {
+		name    string
+		body    string
+		mapping ProviderFieldMapping
+		want    *ExchangeRateResponse
+		wantErr bool
+	}{
+		{
+			name: "v6 response",
+			body: `{"result": "success", "base_code": "USD", "conversion_rates": {"USD": 1, "EUR": 0.9},
+				"time_last_update_unix": 1700000000, "time_last_update_utc": "Tue, 14 Nov 2023 22:13:20 +0000",
+				"time_next_update_unix": 1700086400}`,
+			mapping: defaults[providerExchangeRateAPIv6],
+			want: &ExchangeRateResponse{
+				Result:             "success",
+				BaseCode:           "USD",
+				ConversionRates:    ProviderRates{"USD": 1, "EUR": 0.9},
+				TimeLastUpdateUnix: 1700000000,
+				TimeLastUpdateUTC:  "Tue, 14 Nov 2023 22:13:20 +0000",
+				TimeNextUpdateUnix: 1700086400,
+			},
+		},
+		{
+			name:    "v4 response",
+			body:    `{"base": "EUR", "rates": {"USD": 1.1}, "time_last_updated": 1700000000}`,
+			mapping: defaults[providerExchangeRateAPIv4],
+			want:    &ExchangeRateResponse{BaseCode: "EUR", ConversionRates: ProviderRates{"USD": 1.1}, TimeLastUpdated: 1700000000},
+		},
+		{
+			name:    "nested paths",
+			body:    `{"meta": {"base": "GBP", "updated": 1700000000}, "data": {"rates": {"USD": 1.25}}}`,
+			mapping: nested,
+			want:    &ExchangeRateResponse{BaseCode: "GBP", ConversionRates: ProviderRates{"USD": 1.25}, TimeLastUpdateUnix: 1700000000},
+		},
+		{
+			name:    "numeric string and scientific rates",
+			body:    `{"rates": {"VND": "24500.5", "BTC": 1.5e-5}}`,
+			mapping: defaults[providerExchangeRateAPIv4],
+			want:    &ExchangeRateResponse{ConversionRates: ProviderRates{"VND": 24500.5, "BTC": 1.5e-5}},
+		},
+		{
+			name:    "missing and null optional fields",
+			body:    `{"meta": null, "data": {"rates": {"USD": 1.25}}}`,
+			mapping: nested,
+			want:    &ExchangeRateResponse{ConversionRates: ProviderRates{"USD": 1.25}},
+		},
+		{
+			name:    "wrong field type",
+			body:    `{"base": 42, "rates": {"USD": 1.1}}`,
+			mapping: defaults[providerExchangeRateAPIv4],
+			wantErr: true,
+		},
+		{
+			name:    "invalid rate",
+			body:    `{"rates": {"USD": "n/a"}}`,
+			mapping: defaults[providerExchangeRateAPIv4],
+			wantErr: true,
+		},
+		{
+			name:    "scalar along the path",
+			body:    `{"meta": "v2", "data": {"rates": {"USD": 1.25}}}`,
+			mapping: nested,
+			wantErr: true,
+		},
+		{
+			name:    "not JSON",
+			body:    `<html>busy</html>`,
+			mapping: defaults[providerExchangeRateAPIv4],
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeProviderResponse([]byte(tt.body), tt.mapping)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeProviderResponse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeProviderResponse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
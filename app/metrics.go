@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	metricsModeEMF  = "emf"
+	metricsModeAPI  = "api"
+	metricsModeNone = "none"
+
+	// metricsNamespace is shared with the log metric filters defined in terraform
+	metricsNamespace = "Ahorro/ExchangeRateCooker"
+
+	// putMetricDataBatchSize is the most metrics CloudWatch accepts in one PutMetricData request
+	putMetricDataBatchSize = 1000
+)
+
+// Metrics buffered in api mode until flushMetrics publishes them at the end of the invocation
+var (
+	pendingMetricsMu sync.Mutex
+	pendingMetrics   []types.MetricDatum
+)
+
+// Metric is a single value emitted in an EMF log line or a PutMetricData request.
+type Metric struct {
+	Name  string
+	Unit  string
+	Value float64
+}
+
+type emfMetricDefinition struct {
+	Name string `json:"Name"`
+	Unit string `json:"Unit"`
+}
+
+type emfDirective struct {
+	Namespace  string                `json:"Namespace"`
+	Dimensions [][]string            `json:"Dimensions"`
+	Metrics    []emfMetricDefinition `json:"Metrics"`
+}
+
+type emfMetadata struct {
+	Timestamp         int64          `json:"Timestamp"`
+	CloudWatchMetrics []emfDirective `json:"CloudWatchMetrics"`
+}
+
+// emitMetrics writes the metrics as one CloudWatch Embedded Metric Format line to stdout,
+// where CloudWatch Logs extracts them without any PutMetricData calls. Every metric carries
+// the Stage and Provider dimensions; properties are added as searchable, non-dimension fields.
+// With METRICS_MODE api the metrics are buffered for flushMetrics instead and the properties,
+// which PutMetricData has no place for, are dropped. It is a no-op with METRICS_MODE none.
+func emitMetrics(properties map[string]interface{}, metrics ...Metric) {
+	if len(metrics) == 0 {
+		return
+	}
+	switch metricsMode {
+	case metricsModeEMF:
+	case metricsModeAPI:
+		bufferMetrics(metrics)
+		return
+	default:
+		return
+	}
+
+	definitions := make([]emfMetricDefinition, 0, len(metrics))
+	line := make(map[string]interface{}, len(properties)+len(metrics)+3)
+	for key, value := range properties {
+		line[key] = value
+	}
+	for _, metric := range metrics {
+		definitions = append(definitions, emfMetricDefinition{Name: metric.Name, Unit: metric.Unit})
+		line[metric.Name] = metric.Value
+	}
+
+	line["Stage"] = metricsStage
+	line["Provider"] = activeProviderName()
+	line["_aws"] = emfMetadata{
+		Timestamp: time.Now().UnixMilli(),
+		CloudWatchMetrics: []emfDirective{{
+			Namespace:  metricsNamespace,
+			Dimensions: [][]string{{"Stage", "Provider"}},
+			Metrics:    definitions,
+		}},
+	}
+
+	payload, err := json.Marshal(line)
+	if err != nil {
+		logrus.WithError(err).Warn("Failed to marshal EMF metrics")
+		return
+	}
+	fmt.Fprintln(os.Stdout, string(payload))
+}
+
+// bufferMetrics queues the metrics for the next flushMetrics with the same dimensions as EMF.
+func bufferMetrics(metrics []Metric) {
+	now := time.Now()
+	dimensions := []types.Dimension{
+		{Name: aws.String("Stage"), Value: aws.String(metricsStage)},
+		{Name: aws.String("Provider"), Value: aws.String(activeProviderName())},
+	}
+
+	pendingMetricsMu.Lock()
+	defer pendingMetricsMu.Unlock()
+	for _, metric := range metrics {
+		pendingMetrics = append(pendingMetrics, types.MetricDatum{
+			MetricName: aws.String(metric.Name),
+			Unit:       types.StandardUnit(metric.Unit),
+			Value:      aws.Float64(metric.Value),
+			Timestamp:  aws.Time(now),
+			Dimensions: dimensions,
+		})
+	}
+}
+
+// flushMetrics publishes the metrics buffered in api mode with PutMetricData, in batches of
+// putMetricDataBatchSize. Publishing is best effort: a failed batch is logged and dropped, and
+// never fails the invocation.
+func flushMetrics(ctx context.Context) {
+	pendingMetricsMu.Lock()
+	metrics := pendingMetrics
+	pendingMetrics = nil
+	pendingMetricsMu.Unlock()
+	if len(metrics) == 0 {
+		return
+	}
+
+	if err := ensureAWSClients(ctx); err != nil {
+		logrus.WithError(err).WithField("metrics", len(metrics)).Warn("Failed to publish metrics")
+		return
+	}
+
+	sent := 0
+	for start := 0; start < len(metrics); start += putMetricDataBatchSize {
+		end := min(start+putMetricDataBatchSize, len(metrics))
+		_, err := cloudwatchClient.PutMetricData(ctx, &cloudwatch.PutMetricDataInput{
+			Namespace:  aws.String(metricsNamespace),
+			MetricData: metrics[start:end],
+		})
+		if err != nil {
+			logrus.WithError(err).WithField("metrics", end-start).Warn("Failed to publish metrics batch")
+			continue
+		}
+		sent += end - start
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"sent":   sent,
+		"failed": len(metrics) - sent,
+	}).Debug("Published metrics with PutMetricData")
+}
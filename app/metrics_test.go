@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestEmitMetricsBuffersInAPIMode(t *testing.T) {
+	previousMode, previousStage := metricsMode, metricsStage
+	t.Cleanup(func() {
+		metricsMode, metricsStage = previousMode, previousStage
+		pendingMetrics = nil
+	})
+	metricsMode, metricsStage = metricsModeAPI, "prod"
+	pendingMetrics = nil
+
+	emitMetrics(map[string]interface{}{"Currency": "EUR"},
+		Metric{Name: "FetchLatency", Unit: "Milliseconds", Value: 12.5},
+		Metric{Name: "ErrorCount", Unit: "Count", Value: 2})
+
+	if len(pendingMetrics) != 2 {
+		t.Fatalf("buffered %d metrics, want 2", len(pendingMetrics))
+	}
+	latency := pendingMetrics[0]
+	if aws.ToString(latency.MetricName) != "FetchLatency" || latency.Unit != "Milliseconds" || aws.ToFloat64(latency.Value) != 12.5 {
+		t.Errorf("first metric = %s %s %v, want FetchLatency Milliseconds 12.5", aws.ToString(latency.MetricName), latency.Unit, aws.ToFloat64(latency.Value))
+	}
+	dimensions := make(map[string]string)
+	for _, dimension := range latency.Dimensions {
+		dimensions[aws.ToString(dimension.Name)] = aws.ToString(dimension.Value)
+	}
+	if dimensions["Stage"] != "prod" || dimensions["Provider"] != activeProviderName() || len(dimensions) != 2 {
+		t.Errorf("dimensions = %v, want Stage and Provider only", dimensions)
+	}
+
+	metricsMode = metricsModeNone
+	emitMetrics(nil, Metric{Name: "NoOpRun", Unit: "Count", Value: 1})
+	if len(pendingMetrics) != 2 {
+		t.Errorf("buffered %d metrics with METRICS_MODE none, want no new ones", len(pendingMetrics))
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/sirupsen/logrus"
+)
+
+// How a pair rate was obtained
+const (
+	pairMethodDirect       = "direct"
+	pairMethodInverse      = "inverse"
+	pairMethodTriangulated = "triangulated"
+)
+
+// CurrencyPair is a required base->target pair from REQUIRED_PAIRS.
+type CurrencyPair struct {
+	Base   string
+	Target string
+}
+
+func (p CurrencyPair) String() string {
+	return p.Base + "/" + p.Target
+}
+
+// PairRateRecord stores a single required pair under the Pair#<date> partition.
+type PairRateRecord struct {
+	Key              string    `dynamodbav:"Key"`
+	SortKey          string    `dynamodbav:"SortKey"`
+	Base             string    `dynamodbav:"Base"`
+	Target           string    `dynamodbav:"Target"`
+	Rate             float64   `dynamodbav:"Rate"`
+	Method           string    `dynamodbav:"Method"`
+	Pivot            string    `dynamodbav:"Pivot,omitempty"`
+	UpdatedAt        time.Time `dynamodbav:"UpdatedAt"`
+	ExpiresAt        int64     `dynamodbav:"ExpiresAt"`
+	SchemaVersion    int       `dynamodbav:"SchemaVersion"`
+	WrittenByVersion string    `dynamodbav:"WrittenByVersion,omitempty"`
+}
+
+// parseRequiredPairs parses REQUIRED_PAIRS entries of the form BASE/TARGET.
+func parseRequiredPairs(values []string) ([]CurrencyPair, error) {
+	pairs := make([]CurrencyPair, 0, len(values))
+	for _, value := range values {
+		base, target, ok := strings.Cut(strings.ToUpper(value), "/")
+		if !ok || !isCurrencyCode(base) || !isCurrencyCode(target) || base == target {
+			return nil, fmt.Errorf("REQUIRED_PAIRS entry %q must be distinct BASE/TARGET currency codes", value)
+		}
+		pairs = append(pairs, CurrencyPair{Base: base, Target: target})
+	}
+	return pairs, nil
+}
+
+func isCurrencyCode(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// pairRecordKey is the partition holding the pair records for date.
+func pairRecordKey(date string) string {
+	return prefixedKey("Pair#" + date)
+}
+
+// storeRequiredPairs makes sure every REQUIRED_PAIRS entry is stored for date. A pair is taken
+// from its base's record when present, inverted from its target's record, or triangulated
+// through the PAIR_PIVOT record. It only uses records already stored, so no provider calls
+// are made, and returns the pairs that could not be resolved.
+func storeRequiredPairs(ctx context.Context, date string) ([]string, error) {
+	needed := []string{pairPivot}
+	seen := map[string]bool{pairPivot: true}
+	for _, pair := range requiredPairs {
+		for _, currency := range []string{pair.Base, pair.Target} {
+			if !seen[currency] {
+				seen[currency] = true
+				needed = append(needed, currency)
+			}
+		}
+	}
+
+	records, err := batchCheckExistingExchangeRates(ctx, needed, date)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		if err := resolveExchangeRateView(ctx, record, records); err != nil {
+			return nil, err
+		}
+	}
+
+	var direct, computed, unresolved []string
+	for _, pair := range requiredPairs {
+		if knownUnsupportedPairs[pair] {
+			logrus.WithField("pair", pair.String()).Debug("Required pair is known to be unsupported, skipping")
+			continue
+		}
+
+		rate, method, ok := resolvePair(records, pair)
+		if !ok {
+			unresolved = append(unresolved, pair.String())
+			continue
+		}
+
+		if err := storePairRate(ctx, pair, date, rate, method); err != nil {
+			return nil, err
+		}
+		if method == pairMethodDirect {
+			direct = append(direct, pair.String())
+		} else {
+			computed = append(computed, pair.String())
+		}
+	}
+
+	fields := logrus.Fields{
+		"direct":     direct,
+		"computed":   computed,
+		"unresolved": unresolved,
+		"pivot":      pairPivot,
+	}
+	if len(unresolved) > 0 {
+		logrus.WithFields(fields).Warn("Some required pairs could not be resolved")
+	} else {
+		logrus.WithFields(fields).Info("Required pairs stored")
+	}
+	return unresolved, nil
+}
+
+func resolvePair(records map[string]*ExchangeRateRecord, pair CurrencyPair) (float64, string, bool) {
+	if record := records[pair.Base]; record != nil {
+		if rate, ok := record.ExchangeRates[pair.Target]; ok && rate > 0 {
+			return rate, pairMethodDirect, true
+		}
+	}
+
+	if record := records[pair.Target]; record != nil {
+		if rate, ok := record.ExchangeRates[pair.Base]; ok && rate > 0 {
+			return 1 / rate, pairMethodInverse, true
+		}
+	}
+
+	// One pivot buys baseRate units of the base and targetRate units of the target
+	if record := records[pairPivot]; record != nil {
+		baseRate, baseOK := record.ExchangeRates[pair.Base]
+		targetRate, targetOK := record.ExchangeRates[pair.Target]
+		if baseOK && targetOK && baseRate > 0 && targetRate > 0 {
+			return targetRate / baseRate, pairMethodTriangulated, true
+		}
+	}
+
+	return 0, "", false
+}
+
+func storePairRate(ctx context.Context, pair CurrencyPair, date string, rate float64, method string) error {
+	record := PairRateRecord{
+		Key:              pairRecordKey(date),
+		SortKey:          pair.String(),
+		Base:             pair.Base,
+		Target:           pair.Target,
+		Rate:             rate,
+		Method:           method,
+		UpdatedAt:        time.Now(),
+		ExpiresAt:        time.Now().AddDate(0, 0, ttlIntervalDays).Unix(),
+		SchemaVersion:    pairRateSchemaVersion,
+		WrittenByVersion: buildVersion,
+	}
+	if method == pairMethodTriangulated {
+		record.Pivot = pairPivot
+	}
+
+	item, err := attributevalue.MarshalMap(record)
+	if err != nil {
+		return fmt.Errorf("error marshaling pair record for %s: %w", pair, err)
+	}
+
+	_, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(tableName),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("error storing pair rate for %s: %w", pair, err)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"pair":   pair.String(),
+		"rate":   rate,
+		"method": method,
+		"date":   date,
+	}).Debug("Successfully stored pair rate to DynamoDB")
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestParseRequiredPairs(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  []string
+		want    []CurrencyPair
+		wantErr bool
+	}{
+		{"pairs", []string{"EUR/GBP", "usd/jpy"}, []CurrencyPair{{Base: "EUR", Target: "GBP"}, {Base: "USD", Target: "JPY"}}, false},
+		{"unset", nil, []CurrencyPair{}, false},
+		{"missing separator", []string{"EURGBP"}, nil, true},
+		{"same currency", []string{"EUR/EUR"}, nil, true},
+		{"not a currency code", []string{"EUR/POUND"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRequiredPairs(tt.values)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRequiredPairs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseRequiredPairs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolvePair(t *testing.T) {
+	previous := pairPivot
+	t.Cleanup(func() { pairPivot = previous })
+	pairPivot = "USD"
+
+	records := map[string]*ExchangeRateRecord{
+		"USD": {ExchangeRates: map[string]float64{"EUR": 0.9, "GBP": 0.8, "JPY": 150, "CHF": 0}},
+		"EUR": {ExchangeRates: map[string]float64{"SEK": 11.5}},
+		"NOK": {ExchangeRates: map[string]float64{"DKK": 0.64}},
+	}
+
+	tests := []struct {
+		name       string
+		pair       CurrencyPair
+		wantRate   float64
+		wantMethod string
+		wantOK     bool
+	}{
+		{"direct from the base record", CurrencyPair{"EUR", "SEK"}, 11.5, pairMethodDirect, true},
+		{"direct from the pivot record", CurrencyPair{"USD", "JPY"}, 150, pairMethodDirect, true},
+		{"inverse from the target record", CurrencyPair{"DKK", "NOK"}, 1 / 0.64, pairMethodInverse, true},
+		{"inverse of the pivot", CurrencyPair{"GBP", "USD"}, 1 / 0.8, pairMethodInverse, true},
+		{"triangulated through the pivot", CurrencyPair{"GBP", "JPY"}, 150 / 0.8, pairMethodTriangulated, true},
+		{"triangulated when the base record lacks the target", CurrencyPair{"EUR", "GBP"}, 0.8 / 0.9, pairMethodTriangulated, true},
+		{"zero pivot rate is unusable", CurrencyPair{"CHF", "JPY"}, 0, "", false},
+		{"missing from every record", CurrencyPair{"PLN", "CZK"}, 0, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate, method, ok := resolvePair(records, tt.pair)
+			if math.Abs(rate-tt.wantRate) > 1e-12*tt.wantRate || method != tt.wantMethod || ok != tt.wantOK {
+				t.Errorf("resolvePair(%s) = %v, %q, %v, want %v, %q, %v", tt.pair, rate, method, ok, tt.wantRate, tt.wantMethod, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,729 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	providerExchangeRateAPIv6 = "exchangerate-api-v6"
+	providerExchangeRateAPIv4 = "exchangerate-api-v4"
+)
+
+// ProviderProfile controls how hard we try against a single provider. TimeoutMs bounds a whole
+// attempt, while ConnectTimeoutMs (until response headers arrive) and BodyTimeoutMs (reading the
+// body) bound the individual phases so slow-connect and slow-body providers can be tuned apart.
+type ProviderProfile struct {
+	TimeoutMs        int `json:"timeout_ms"`
+	ConnectTimeoutMs int `json:"connect_timeout_ms"`
+	BodyTimeoutMs    int `json:"body_timeout_ms"`
+	MaxRetries       int `json:"max_retries"`
+	BackoffMs        int `json:"backoff_ms"`
+	MaxBackoffMs     int `json:"max_backoff_ms"`
+}
+
+// How much of a response body is inspected to detect non-JSON responses, and how much of it is
+// kept in the resulting error
+const (
+	nonJSONSniffBytes   = 512
+	nonJSONSnippetBytes = 200
+)
+
+// errProviderBudgetExhausted is returned once MAX_PROVIDER_CALLS_PER_RUN requests were sent.
+var errProviderBudgetExhausted = errors.New("provider call budget for this run exhausted")
+
+// errProviderEmptyRates is returned when the provider reports success without any rates.
+var errProviderEmptyRates = errors.New("provider returned an empty conversion_rates map")
+
+// providerCallsThisRun counts requests sent to the provider during the current invocation.
+var providerCallsThisRun atomic.Int64
+
+// providerUnsupported holds the configured currencies the provider did not list when codes
+// were verified at cold start. They are left out of the run's completeness.
+var providerUnsupported = make(map[string]bool)
+
+// loadKnownUnsupported parses KNOWN_UNSUPPORTED entries, either a currency code the provider
+// never serves as a base or a BASE/TARGET pair it never quotes.
+func loadKnownUnsupported(values []string) (map[string]bool, map[CurrencyPair]bool, error) {
+	currencies := make(map[string]bool)
+	pairs := make(map[CurrencyPair]bool)
+	for _, value := range values {
+		entry := strings.ToUpper(value)
+		if isCurrencyCode(entry) {
+			currencies[entry] = true
+			continue
+		}
+		base, target, ok := strings.Cut(entry, "/")
+		if !ok || !isCurrencyCode(base) || !isCurrencyCode(target) || base == target {
+			return nil, nil, fmt.Errorf("KNOWN_UNSUPPORTED entry %q must be a currency code or a distinct BASE/TARGET pair", value)
+		}
+		pairs[CurrencyPair{Base: base, Target: target}] = true
+	}
+	return currencies, pairs, nil
+}
+
+// ProviderStatusError is returned when a provider answers with a non-200 status. RetryAfter is
+// set when the response carried a valid Retry-After header.
+type ProviderStatusError struct {
+	StatusCode int
+	RetryAfter time.Duration
+}
+
+func (e *ProviderStatusError) Error() string {
+	return fmt.Sprintf("API returned status %d", e.StatusCode)
+}
+
+// ProviderResultError is returned when a provider answers but reports a failed result.
+type ProviderResultError struct {
+	Result string
+}
+
+func (e *ProviderResultError) Error() string {
+	return fmt.Sprintf("API call failed with result: %s", e.Result)
+}
+
+// ProviderTimeoutError is returned when a phase of a provider request overran its deadline.
+type ProviderTimeoutError struct {
+	Phase   string
+	Timeout time.Duration
+}
+
+func (e *ProviderTimeoutError) Error() string {
+	return fmt.Sprintf("provider %s phase timed out after %s", e.Phase, e.Timeout)
+}
+
+// ProviderPinError is returned when TLS pinning is configured and none of the certificates
+// presented by the provider match a pinned public key.
+type ProviderPinError struct {
+	Host string
+}
+
+func (e *ProviderPinError) Error() string {
+	return fmt.Sprintf("security: certificate public key of %s does not match any configured TLS pin", e.Host)
+}
+
+// ProviderNonJSONError is returned when a provider answers 200 with something other than JSON,
+// typically an HTML error page during an incident. Snippet holds the start of the body.
+type ProviderNonJSONError struct {
+	ContentType string
+	Snippet     string
+}
+
+func (e *ProviderNonJSONError) Error() string {
+	return fmt.Sprintf("provider returned non-JSON response (content type %q): %s", e.ContentType, e.Snippet)
+}
+
+// ProviderRates decodes a provider rate map tolerantly: rates may be JSON numbers, including
+// scientific notation, or numeric strings. Any other value fails with the offending target.
+type ProviderRates map[string]float64
+
+func (r *ProviderRates) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	rates := make(ProviderRates, len(raw))
+	for target, value := range raw {
+		rate, err := parseRate(value)
+		if err != nil {
+			return fmt.Errorf("invalid rate for target %s: %w", target, err)
+		}
+		rates[target] = rate
+	}
+	*r = rates
+	return nil
+}
+
+func parseRate(value json.RawMessage) (float64, error) {
+	text := string(bytes.TrimSpace(value))
+	if strings.HasPrefix(text, `"`) {
+		if err := json.Unmarshal(value, &text); err != nil {
+			return 0, err
+		}
+		text = strings.TrimSpace(text)
+	}
+
+	rate, err := strconv.ParseFloat(text, 64)
+	if err != nil || math.IsNaN(rate) || math.IsInf(rate, 0) {
+		return 0, fmt.Errorf("%q is not a number", text)
+	}
+	return rate, nil
+}
+
+func defaultProviderProfile() ProviderProfile {
+	return ProviderProfile{
+		TimeoutMs:        10000,
+		ConnectTimeoutMs: 5000,
+		BodyTimeoutMs:    5000,
+		MaxRetries:       2,
+		BackoffMs:        500,
+		MaxBackoffMs:     5000,
+	}
+}
+
+// loadProviderProfiles parses PROVIDER_PROFILES, a JSON object keyed by provider name, e.g.
+// {"exchangerate-api-v6": {"timeout_ms": 5000, "max_retries": 3}}. Fields that are not set
+// keep their default values.
+func loadProviderProfiles(profilesJSON string) (map[string]ProviderProfile, error) {
+	profiles := map[string]ProviderProfile{
+		providerExchangeRateAPIv6: defaultProviderProfile(),
+		providerExchangeRateAPIv4: defaultProviderProfile(),
+	}
+	if profilesJSON == "" {
+		return profiles, nil
+	}
+
+	var overrides map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(profilesJSON), &overrides); err != nil {
+		return nil, fmt.Errorf("PROVIDER_PROFILES must be a valid JSON object: %w", err)
+	}
+
+	for name, raw := range overrides {
+		profile, ok := profiles[name]
+		if !ok {
+			return nil, fmt.Errorf("PROVIDER_PROFILES references unknown provider %q", name)
+		}
+		if err := json.Unmarshal(raw, &profile); err != nil {
+			return nil, fmt.Errorf("PROVIDER_PROFILES contains an invalid profile for %s: %w", name, err)
+		}
+		if profile.TimeoutMs <= 0 || profile.ConnectTimeoutMs <= 0 || profile.BodyTimeoutMs <= 0 || profile.MaxRetries < 0 || profile.BackoffMs < 0 || profile.MaxBackoffMs < profile.BackoffMs {
+			return nil, fmt.Errorf("PROVIDER_PROFILES contains out of range values for %s", name)
+		}
+		profiles[name] = profile
+	}
+
+	return profiles, nil
+}
+
+// activeProviderName returns the provider used for fetching: the keyed v6 API when an API key
+// is configured, otherwise the open v4 API.
+func activeProviderName() string {
+	if apiKey != "" {
+		return providerExchangeRateAPIv6
+	}
+	return providerExchangeRateAPIv4
+}
+
+func providerURL(provider, baseCurrency string) string {
+	if provider == providerExchangeRateAPIv6 {
+		return fmt.Sprintf("https://v6.exchangerate-api.com/v6/%s/latest/%s", apiKey, baseCurrency)
+	}
+	return fmt.Sprintf("https://api.exchangerate-api.com/v4/latest/%s", baseCurrency)
+}
+
+// codesResponse is the v6 supported codes payload, a list of [code, name] pairs.
+type codesResponse struct {
+	Result         string     `json:"result"`
+	SupportedCodes [][]string `json:"supported_codes"`
+}
+
+// verifyProviderCodes checks the configured currencies against the provider's supported codes
+// and warns about, or with the fail policy refuses to start on, any the provider doesn't list.
+// The codes are fetched once per container; only the v6 API exposes a codes endpoint.
+func verifyProviderCodes(ctx context.Context) {
+	provider := activeProviderName()
+	if provider != providerExchangeRateAPIv6 {
+		logrus.WithField("provider", provider).Warn("Provider has no supported codes endpoint, skipping currency verification")
+		return
+	}
+
+	codes, err := fetchProviderCodes(ctx, providerProfiles[provider])
+	if err != nil {
+		// Verification is advisory, a provider hiccup at cold start must not block the run
+		logrus.WithError(err).WithField("provider", provider).Warn("Failed to fetch supported codes, skipping currency verification")
+		return
+	}
+
+	var unsupported []string
+	for _, currency := range supportedCurrencies {
+		// Currencies already declared unsupported are expected to be missing
+		if !codes[currency] && !knownUnsupportedCurrencies[currency] {
+			unsupported = append(unsupported, currency)
+		}
+	}
+
+	logger := logrus.WithFields(logrus.Fields{
+		"provider":         provider,
+		"provider_codes":   len(codes),
+		"unsupported":      unsupported,
+		"verify_policy":    verifyCodesPolicy,
+		"configured_count": len(supportedCurrencies),
+	})
+	if len(unsupported) == 0 {
+		logger.Info("All configured currencies are supported by the provider")
+		return
+	}
+	if verifyCodesPolicy == "fail" {
+		logger.Fatal("Configured currencies are not supported by the provider")
+	}
+	logger.Warn("Configured currencies are not supported by the provider")
+	for _, currency := range unsupported {
+		providerUnsupported[currency] = true
+	}
+}
+
+func fetchProviderCodes(ctx context.Context, profile ProviderProfile) (map[string]bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(profile.TimeoutMs)*time.Millisecond)
+	defer cancel()
+
+	url := fmt.Sprintf("https://v6.exchangerate-api.com/v6/%s/codes", apiKey)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build codes request: %w", err)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch supported codes: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &ProviderStatusError{StatusCode: resp.StatusCode}
+	}
+
+	var payload codesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return nil, fmt.Errorf("failed to decode supported codes: %w", err)
+	}
+	if payload.Result != "" && payload.Result != "success" {
+		return nil, &ProviderResultError{Result: payload.Result}
+	}
+
+	codes := make(map[string]bool, len(payload.SupportedCodes))
+	for _, pair := range payload.SupportedCodes {
+		if len(pair) > 0 {
+			codes[pair[0]] = true
+		}
+	}
+	return codes, nil
+}
+
+// newHTTPClient builds the client used for provider calls. The transport keeps idle
+// connections open so that consecutive fetches against the same host reuse them
+// instead of paying for a new TLS handshake every time.
+func newHTTPClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = httpMaxIdleConns
+	transport.MaxIdleConnsPerHost = httpMaxIdleConnsPerHost
+	transport.IdleConnTimeout = time.Duration(httpIdleConnTimeoutSeconds) * time.Second
+
+	transport.TLSClientConfig = &tls.Config{
+		MinVersion:   tlsMinVersion,
+		CipherSuites: tlsCipherSuites,
+	}
+	if len(tlsPins) > 0 {
+		// VerifyConnection runs after the standard chain verification, so pinning only narrows it
+		transport.TLSClientConfig.VerifyConnection = verifyTLSPins
+	}
+
+	return &http.Client{Transport: transport}
+}
+
+// parseTLSVersion parses TLS_MIN_VERSION, either 1.2 or 1.3.
+func parseTLSVersion(value string) (uint16, error) {
+	switch value {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("TLS_MIN_VERSION must be 1.2 or 1.3, got %q", value)
+	}
+}
+
+// parseCipherSuites resolves TLS_CIPHER_SUITES names, as listed by tls.CipherSuites, to their
+// IDs. Insecure suites are rejected. An empty list keeps Go's default selection.
+func parseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+
+	suites := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("TLS_CIPHER_SUITES contains unknown or insecure cipher suite %q", name)
+		}
+		suites = append(suites, id)
+	}
+	return suites, nil
+}
+
+// loadTLSPins parses TLS_PIN values, each the base64 SHA-256 of a certificate's
+// SubjectPublicKeyInfo, optionally prefixed with "sha256/".
+func loadTLSPins(values []string) ([][]byte, error) {
+	pins := make([][]byte, 0, len(values))
+	for _, value := range values {
+		pin, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, "sha256/"))
+		if err != nil || len(pin) != sha256.Size {
+			return nil, fmt.Errorf("TLS_PIN %q must be a base64 encoded SHA-256 of the certificate public key", value)
+		}
+		pins = append(pins, pin)
+	}
+	return pins, nil
+}
+
+// verifyTLSPins accepts the connection when any certificate in the verified chain has a pinned
+// public key, so pinning either the leaf or an intermediate works.
+func verifyTLSPins(state tls.ConnectionState) error {
+	certificates := state.PeerCertificates
+	if len(state.VerifiedChains) > 0 {
+		certificates = state.VerifiedChains[0]
+	}
+
+	for _, certificate := range certificates {
+		if spkiPinned(certificate) {
+			return nil
+		}
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"host":         state.ServerName,
+		"certificates": len(certificates),
+	}).Error("Provider certificate does not match the configured TLS pin")
+	return &ProviderPinError{Host: state.ServerName}
+}
+
+func spkiPinned(certificate *x509.Certificate) bool {
+	sum := sha256.Sum256(certificate.RawSubjectPublicKeyInfo)
+	for _, pin := range tlsPins {
+		if bytes.Equal(sum[:], pin) {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchExchangeRates fetches the latest rates for baseCurrency, retrying according to the
+// active provider's profile.
+func fetchExchangeRates(ctx context.Context, logger *logrus.Entry, baseCurrency string) (rates *ExchangeRateResponse, err error) {
+	// Validate baseCurrency
+	if len(baseCurrency) != 3 {
+		return nil, fmt.Errorf("baseCurrency must be 3 characters")
+	}
+	for _, r := range baseCurrency {
+		if r < 'A' || r > 'Z' {
+			return nil, fmt.Errorf("baseCurrency must be uppercase letters")
+		}
+	}
+
+	provider := activeProviderName()
+	profile := providerProfiles[provider]
+	url := providerURL(provider, baseCurrency)
+
+	if cached := lookupProviderCache(ctx, logger.WithField("provider", provider), provider, baseCurrency); cached != nil {
+		return cached, nil
+	}
+
+	ctx, endSpan := startSpan(ctx, "provider.fetch", fetchDuration,
+		attribute.String("currency", baseCurrency), attribute.String("provider", provider))
+	defer func() { endSpan(err) }()
+
+	logger = logger.WithField("provider", provider)
+
+	var lastErr error
+	for attempt := 0; attempt <= profile.MaxRetries; attempt++ {
+		if attempt > 0 {
+			delay := profile.backoff(attempt)
+
+			// Honor the provider's Retry-After when it asks for a longer pause than our backoff
+			var statusErr *ProviderStatusError
+			if errors.As(lastErr, &statusErr) && statusErr.RetryAfter > delay {
+				delay = statusErr.RetryAfter
+				logger.WithField("retry_after_ms", delay.Milliseconds()).Info("Honoring provider Retry-After")
+			}
+
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= delay {
+				logger.WithFields(logrus.Fields{
+					"delay_ms":     delay.Milliseconds(),
+					"remaining_ms": time.Until(deadline).Milliseconds(),
+				}).Warn("Retry delay exceeds remaining time budget, giving up")
+				break
+			}
+
+			logger.WithFields(logrus.Fields{
+				"attempt":  attempt + 1,
+				"delay_ms": delay.Milliseconds(),
+			}).WithError(lastErr).Warn("Retrying exchange rates fetch")
+
+			select {
+			case <-ctx.Done():
+				return nil, fmt.Errorf("fetch cancelled before retry: %w", lastErr)
+			case <-time.After(delay):
+			}
+		}
+
+		// Every attempt, retries included, counts against the per-run budget
+		if maxProviderCallsPerRun > 0 && providerCallsThisRun.Load() >= int64(maxProviderCallsPerRun) {
+			if lastErr != nil {
+				return nil, fmt.Errorf("%w: %v", errProviderBudgetExhausted, lastErr)
+			}
+			return nil, errProviderBudgetExhausted
+		}
+		providerCallsThisRun.Add(1)
+
+		rates, fetchErr := fetchExchangeRatesOnce(ctx, logger, url, profile, providerFieldMappings[provider])
+		if fetchErr == nil {
+			rates.FetchMeta.Attempts = attempt + 1
+			logger.WithField("fetch_meta", rates.FetchMeta).Debug("Provider fetch completed")
+			storeProviderCache(ctx, logger, provider, baseCurrency, rates)
+			return rates, nil
+		}
+		lastErr = fetchErr
+
+		if !isRetryableFetchError(lastErr) {
+			break
+		}
+	}
+
+	return nil, lastErr
+}
+
+func fetchExchangeRatesOnce(ctx context.Context, logger *logrus.Entry, url string, profile ProviderProfile, mapping ProviderFieldMapping) (*ExchangeRateResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(profile.TimeoutMs)*time.Millisecond)
+	defer cancel()
+
+	// Phase timers cancel the request when the connect or body phase overruns; timedOut
+	// remembers which one fired so the resulting error can name the phase
+	var timedOut atomic.Pointer[ProviderTimeoutError]
+	armPhaseTimer := func(phase string, timeoutMs int) *time.Timer {
+		timeout := time.Duration(timeoutMs) * time.Millisecond
+		return time.AfterFunc(timeout, func() {
+			timedOut.Store(&ProviderTimeoutError{Phase: phase, Timeout: timeout})
+			cancel()
+		})
+	}
+	phaseError := func(err error) error {
+		if phaseErr := timedOut.Load(); phaseErr != nil {
+			logger.WithFields(logrus.Fields{
+				"phase":      phaseErr.Phase,
+				"timeout_ms": phaseErr.Timeout.Milliseconds(),
+			}).Warn("Provider request timed out")
+			return phaseErr
+		}
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+
+	startedAt := time.Now()
+	connectTimer := armPhaseTimer("connect", profile.ConnectTimeoutMs)
+	resp, err := httpClient.Do(req)
+	connectTimer.Stop()
+	if err != nil {
+		return nil, phaseError(fmt.Errorf("failed to fetch exchange rates: %w", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &ProviderStatusError{
+			StatusCode: resp.StatusCode,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	}
+
+	bodyTimer := armPhaseTimer("body", profile.BodyTimeoutMs)
+	defer bodyTimer.Stop()
+
+	body := bufio.NewReaderSize(resp.Body, nonJSONSniffBytes)
+	contentType := resp.Header.Get("Content-Type")
+	logger.WithField("content_type", contentType).Debug("Provider response received")
+	if head, err := body.Peek(nonJSONSniffBytes); !looksLikeJSON(contentType, head) {
+		if err != nil && !errors.Is(err, io.EOF) && len(head) == 0 {
+			return nil, phaseError(fmt.Errorf("failed to read response: %w", err))
+		}
+		logger.WithField("content_type", contentType).Warn("Provider returned a non-JSON response")
+		return nil, &ProviderNonJSONError{ContentType: contentType, Snippet: bodySnippet(head)}
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, phaseError(fmt.Errorf("failed to read response: %w", err))
+	}
+	exchangeRates, err := decodeProviderResponse(data, mapping)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	exchangeRates.FetchMeta = newFetchMeta(resp, startedAt)
+
+	// Check if the API call was successful (for the paid API version)
+	if exchangeRates.Result != "" && exchangeRates.Result != "success" {
+		return nil, &ProviderResultError{Result: exchangeRates.Result}
+	}
+
+	// A successful response without rates is a known provider glitch; retrying usually helps
+	if len(exchangeRates.ConversionRates) == 0 {
+		logger.Warn("Provider returned success with empty conversion rates")
+		return nil, errProviderEmptyRates
+	}
+
+	remapCurrencyCodes(logger, exchangeRates)
+	exchangeRates.RateTimestamp = providerTimestamp(logger, exchangeRates)
+
+	return exchangeRates, nil
+}
+
+// looksLikeJSON reports whether a response with contentType starting with head can be JSON. An
+// explicit HTML or XML content type is never JSON; otherwise the first non-space byte decides,
+// since some providers label JSON as text/plain.
+func looksLikeJSON(contentType string, head []byte) bool {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		if mediaType == "text/html" || strings.HasSuffix(mediaType, "xml") {
+			return false
+		}
+	}
+
+	trimmed := bytes.TrimLeft(head, " \t\r\n")
+	return len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[')
+}
+
+// bodySnippet returns at most nonJSONSnippetBytes of head with whitespace collapsed, for logs.
+func bodySnippet(head []byte) string {
+	snippet := strings.Join(strings.Fields(string(head)), " ")
+	if len(snippet) > nonJSONSnippetBytes {
+		snippet = snippet[:nonJSONSnippetBytes] + "..."
+	}
+	return snippet
+}
+
+// providerTimestamp returns the provider's publish time in UTC, preferring the unix forms and
+// falling back to the UTC string. When none can be parsed it falls back to the current time.
+func providerTimestamp(logger *logrus.Entry, rates *ExchangeRateResponse) time.Time {
+	if rates.TimeLastUpdateUnix > 0 {
+		return time.Unix(rates.TimeLastUpdateUnix, 0).UTC()
+	}
+	if rates.TimeLastUpdated > 0 {
+		return time.Unix(rates.TimeLastUpdated, 0).UTC()
+	}
+
+	if rates.TimeLastUpdateUTC != "" {
+		for _, layout := range []string{time.RFC1123Z, time.RFC1123, time.RFC3339} {
+			if timestamp, err := time.Parse(layout, rates.TimeLastUpdateUTC); err == nil {
+				return timestamp.UTC()
+			}
+		}
+	}
+
+	logger.WithField("time_last_update_utc", rates.TimeLastUpdateUTC).Warn("Provider update time missing or unparseable, using fetch time as rate timestamp")
+	return time.Now().UTC()
+}
+
+// parseRetryAfter parses a Retry-After header given either as delay seconds or as an HTTP-date.
+// It returns zero when the header is missing, invalid or already in the past.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds <= 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
+
+// backoff returns the exponential delay before the given retry attempt, capped at MaxBackoffMs.
+func (p ProviderProfile) backoff(attempt int) time.Duration {
+	delay := time.Duration(p.BackoffMs) * time.Millisecond
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+	}
+
+	maxDelay := time.Duration(p.MaxBackoffMs) * time.Millisecond
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
+
+// isRetryableFetchError reports whether another attempt could succeed. Client errors other
+// than rate limiting, failed results reported by the provider and pin mismatches are permanent.
+func isRetryableFetchError(err error) bool {
+	var pinErr *ProviderPinError
+	if errors.As(err, &pinErr) {
+		return false
+	}
+
+	var statusErr *ProviderStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500
+	}
+
+	var resultErr *ProviderResultError
+	return !errors.As(err, &resultErr)
+}
+
+// fetchMetaHeaders are the response headers kept in FetchMeta. It is an allow-list so
+// cookies, auth or anything else sensitive a provider might echo back is never stored.
+var fetchMetaHeaders = []string{
+	"Date",
+	"Age",
+	"X-RateLimit-Limit",
+	"X-RateLimit-Remaining",
+	"X-RateLimit-Reset",
+}
+
+// FetchMeta describes a successful provider response for auditing provider behavior and quota
+// use over time.
+type FetchMeta struct {
+	StatusCode int               `dynamodbav:"StatusCode" json:"status_code"`
+	LatencyMs  int64             `dynamodbav:"LatencyMs" json:"latency_ms"`
+	Attempts   int               `dynamodbav:"Attempts" json:"attempts"`
+	Headers    map[string]string `dynamodbav:"Headers,omitempty" json:"headers,omitempty"`
+	FetchedAt  time.Time         `dynamodbav:"FetchedAt" json:"fetched_at"`
+}
+
+func newFetchMeta(resp *http.Response, startedAt time.Time) *FetchMeta {
+	meta := &FetchMeta{
+		StatusCode: resp.StatusCode,
+		LatencyMs:  time.Since(startedAt).Milliseconds(),
+		Attempts:   1,
+		FetchedAt:  startedAt.UTC(),
+	}
+	for _, name := range fetchMetaHeaders {
+		if value := resp.Header.Get(name); value != "" {
+			if meta.Headers == nil {
+				meta.Headers = make(map[string]string)
+			}
+			meta.Headers[name] = value
+		}
+	}
+	return meta
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		min   time.Duration
+		max   time.Duration
+	}{
+		{"missing", "", 0, 0},
+		{"delay seconds", "120", 120 * time.Second, 120 * time.Second},
+		{"zero seconds", "0", 0, 0},
+		{"negative seconds", "-5", 0, 0},
+		{"garbage", "soon", 0, 0},
+		{"fractional seconds", "1.5", 0, 0},
+		{"future HTTP-date", time.Now().Add(90 * time.Second).UTC().Format(http.TimeFormat), 85 * time.Second, 90 * time.Second},
+		{"past HTTP-date", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseRetryAfter(tt.value)
+			if got < tt.min || got > tt.max {
+				t.Errorf("parseRetryAfter(%q) = %v, want between %v and %v", tt.value, got, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestFetchCarriesRetryAfter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	previous := httpClient
+	t.Cleanup(func() { httpClient = previous })
+	httpClient = server.Client()
+
+	_, err := fetchExchangeRatesOnce(context.Background(), logrus.NewEntry(logrus.StandardLogger()), server.URL, defaultProviderProfile(), defaultProviderFieldMappings()[providerExchangeRateAPIv6])
+
+	var statusErr *ProviderStatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("fetchExchangeRatesOnce() error = %v, want *ProviderStatusError", err)
+	}
+	if statusErr.StatusCode != http.StatusTooManyRequests || statusErr.RetryAfter != 7*time.Second {
+		t.Errorf("got status %d retry after %v, want %d and 7s", statusErr.StatusCode, statusErr.RetryAfter, http.StatusTooManyRequests)
+	}
+}
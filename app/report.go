@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	reportFormatMarkdown = "markdown"
+	reportFormatHTML     = "html"
+)
+
+// reportEnabled reports whether a daily rate report should be uploaded after each run.
+func reportEnabled() bool {
+	return reportBucket != ""
+}
+
+// publishRateReport renders the stored rates for date between all supported currencies and
+// uploads the report to REPORT_BUCKET. Currencies without a record for the day are left blank.
+// The day's records are read in one BatchGetItem pass and view records resolved from them.
+func publishRateReport(ctx context.Context, date string) error {
+	records, err := batchCheckExistingExchangeRates(ctx, supportedCurrencies, date)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		if err := resolveExchangeRateView(ctx, record, records); err != nil {
+			return err
+		}
+	}
+
+	var body, contentType, extension string
+	if reportFormat == reportFormatHTML {
+		body, contentType, extension = renderHTMLReport(date, records), "text/html; charset=utf-8", "html"
+	} else {
+		body, contentType, extension = renderMarkdownReport(date, records), "text/markdown; charset=utf-8", "md"
+	}
+
+	key := path.Join(reportPrefix, fmt.Sprintf("%s.%s", date, extension))
+	_, err = s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(reportBucket),
+		Key:         aws.String(key),
+		Body:        strings.NewReader(body),
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return fmt.Errorf("error uploading rate report for %s: %w", date, err)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"bucket":     reportBucket,
+		"object_key": key,
+		"format":     reportFormat,
+		"currencies": len(records),
+	}).Info("Rate report uploaded to S3")
+	return nil
+}
+
+func renderMarkdownReport(date string, records map[string]*ExchangeRateRecord) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Exchange rates for %s\n\n", date)
+
+	b.WriteString("| Base |")
+	for _, target := range supportedCurrencies {
+		fmt.Fprintf(&b, " %s |", target)
+	}
+	b.WriteString("\n|---|")
+	for range supportedCurrencies {
+		b.WriteString("---:|")
+	}
+	b.WriteString("\n")
+
+	for _, baseCurrency := range supportedCurrencies {
+		fmt.Fprintf(&b, "| %s%s |", baseCurrency, reportMarker(records[baseCurrency]))
+		for _, target := range supportedCurrencies {
+			fmt.Fprintf(&b, " %s |", reportCell(records[baseCurrency], target))
+		}
+		b.WriteString("\n")
+	}
+
+	fmt.Fprintf(&b, "\n_Generated %s. * marks degraded or suspect data._\n", time.Now().UTC().Format(time.RFC3339))
+	return b.String()
+}
+
+func renderHTMLReport(date string, records map[string]*ExchangeRateRecord) string {
+	var b strings.Builder
+	title := html.EscapeString(fmt.Sprintf("Exchange rates for %s", date))
+	fmt.Fprintf(&b, "<!DOCTYPE html>\n<html>\n<head><meta charset=\"utf-8\"><title>%s</title></head>\n<body>\n<h1>%s</h1>\n<table>\n<tr><th>Base</th>", title, title)
+	for _, target := range supportedCurrencies {
+		fmt.Fprintf(&b, "<th>%s</th>", html.EscapeString(target))
+	}
+	b.WriteString("</tr>\n")
+
+	for _, baseCurrency := range supportedCurrencies {
+		fmt.Fprintf(&b, "<tr><th>%s</th>", html.EscapeString(baseCurrency+reportMarker(records[baseCurrency])))
+		for _, target := range supportedCurrencies {
+			fmt.Fprintf(&b, "<td align=\"right\">%s</td>", html.EscapeString(reportCell(records[baseCurrency], target)))
+		}
+		b.WriteString("</tr>\n")
+	}
+
+	fmt.Fprintf(&b, "</table>\n<p><em>Generated %s. * marks degraded or suspect data.</em></p>\n</body>\n</html>\n", time.Now().UTC().Format(time.RFC3339))
+	return b.String()
+}
+
+func reportCell(record *ExchangeRateRecord, target string) string {
+	if record == nil {
+		return ""
+	}
+	rate, ok := record.ExchangeRates[target]
+	if !ok {
+		return ""
+	}
+	return strconv.FormatFloat(rate, 'f', -1, 64)
+}
+
+func reportMarker(record *ExchangeRateRecord) string {
+	if record != nil && (record.Degraded || record.Suspect) {
+		return "*"
+	}
+	return ""
+}
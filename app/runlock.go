@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/sirupsen/logrus"
+)
+
+const runLockKey = "RunLock"
+
+type RunLockRecord struct {
+	Key           string    `dynamodbav:"Key"`
+	SortKey       string    `dynamodbav:"SortKey"`
+	Owner         string    `dynamodbav:"Owner"`
+	AcquiredAt    time.Time `dynamodbav:"AcquiredAt"`
+	ExpiresAt     int64     `dynamodbav:"ExpiresAt"`
+	SchemaVersion int       `dynamodbav:"SchemaVersion"`
+}
+
+// invocationID identifies the current invocation, using the Lambda request ID when available.
+// It names the run lock owner and the run in failure messages.
+func invocationID(ctx context.Context) string {
+	if lc, ok := lambdacontext.FromContext(ctx); ok && lc.AwsRequestID != "" {
+		return lc.AwsRequestID
+	}
+	return strconv.FormatInt(time.Now().UnixNano(), 10)
+}
+
+// acquireRunLock takes the run lock with a conditional put. It succeeds when no lock exists or
+// the existing lease has expired, which also covers invocations that died without releasing it,
+// since TTL deletion itself can lag by hours. It returns false when another run holds the lock.
+func acquireRunLock(ctx context.Context, owner string) (bool, error) {
+	now := time.Now()
+	record := RunLockRecord{
+		Key:           prefixedKey(runLockKey),
+		SortKey:       "-",
+		Owner:         owner,
+		AcquiredAt:    now,
+		ExpiresAt:     now.Add(time.Duration(runLockLeaseSeconds) * time.Second).Unix(),
+		SchemaVersion: runLockSchemaVersion,
+	}
+
+	item, err := attributevalue.MarshalMap(record)
+	if err != nil {
+		return false, fmt.Errorf("error marshaling run lock: %w", err)
+	}
+
+	values, err := attributevalue.MarshalMap(map[string]interface{}{
+		":now": now.Unix(),
+	})
+	if err != nil {
+		return false, fmt.Errorf("error marshaling run lock condition: %w", err)
+	}
+
+	_, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:                 aws.String(tableName),
+		Item:                      item,
+		ConditionExpression:       aws.String("attribute_not_exists(#key) OR ExpiresAt < :now"),
+		ExpressionAttributeNames:  map[string]string{"#key": "Key"},
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		var conditionErr *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionErr) {
+			return false, nil
+		}
+		return false, fmt.Errorf("error acquiring run lock: %w", err)
+	}
+
+	return true, nil
+}
+
+// releaseRunLock deletes the run lock if it is still held by owner.
+func releaseRunLock(ctx context.Context, owner string) {
+	keyItem, err := attributevalue.MarshalMap(map[string]interface{}{
+		"Key":     prefixedKey(runLockKey),
+		"SortKey": "-",
+	})
+	if err != nil {
+		logrus.WithError(err).Error("Failed to marshal run lock key")
+		return
+	}
+
+	values, err := attributevalue.MarshalMap(map[string]interface{}{
+		":owner": owner,
+	})
+	if err != nil {
+		logrus.WithError(err).Error("Failed to marshal run lock owner")
+		return
+	}
+
+	_, err = dynamoClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:                 aws.String(tableName),
+		Key:                       keyItem,
+		ConditionExpression:       aws.String("#owner = :owner"),
+		ExpressionAttributeNames:  map[string]string{"#owner": "Owner"},
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		var conditionErr *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionErr) {
+			// The lease expired and another run took over, leave its lock alone
+			logrus.WithField("owner", owner).Warn("Run lock was taken over before release")
+			return
+		}
+		logrus.WithError(err).Error("Failed to release run lock, it will expire with its lease")
+		return
+	}
+
+	logrus.WithField("owner", owner).Debug("Run lock released")
+}
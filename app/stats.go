@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Per-currency outcomes recorded in RunStats
+const (
+	outcomeSuccess       = "success"
+	outcomeError         = "error"
+	outcomeSkipped       = "skipped"
+	outcomeDeadLettered  = "dead_lettered"
+	outcomeDegraded      = "degraded"
+	outcomeSkippedBudget = "skipped_budget"
+	outcomeUnsupported   = "unsupported"
+)
+
+var runOutcomes = []string{outcomeSuccess, outcomeError, outcomeSkipped, outcomeDeadLettered, outcomeDegraded, outcomeSkippedBudget, outcomeUnsupported}
+
+// RunStats collects the outcome of every currency processed during a run. It is safe for
+// concurrent use by multiple workers.
+type RunStats struct {
+	counts map[string]*atomic.Int64
+
+	mu       sync.Mutex
+	outcomes map[string][]string
+	errors   []recordedError
+}
+
+func NewRunStats() *RunStats {
+	counts := make(map[string]*atomic.Int64, len(runOutcomes))
+	for _, outcome := range runOutcomes {
+		counts[outcome] = new(atomic.Int64)
+	}
+
+	return &RunStats{
+		counts:   counts,
+		outcomes: make(map[string][]string),
+	}
+}
+
+// Record counts an outcome for the currency and remembers it as the currency's latest outcome.
+func (s *RunStats) Record(ctx context.Context, baseCurrency, outcome string) {
+	s.counts[outcome].Add(1)
+
+	s.mu.Lock()
+	s.outcomes[baseCurrency] = append(s.outcomes[baseCurrency], outcome)
+	s.mu.Unlock()
+
+	recordCurrencyOutcome(ctx, baseCurrency, outcome)
+}
+
+// Forget removes every outcome and error recorded for the currency, so a currency that is
+// processed again is only counted with its new outcomes.
+func (s *RunStats) Forget(baseCurrency string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, outcome := range s.outcomes[baseCurrency] {
+		s.counts[outcome].Add(-1)
+	}
+	delete(s.outcomes, baseCurrency)
+
+	kept := s.errors[:0]
+	for _, recorded := range s.errors {
+		if recorded.currency != baseCurrency {
+			kept = append(kept, recorded)
+		}
+	}
+	s.errors = kept
+}
+
+// Count returns how many times the outcome was recorded.
+func (s *RunStats) Count(outcome string) int {
+	return int(s.counts[outcome].Load())
+}
+
+// Outcomes returns a copy of the latest outcome per currency.
+func (s *RunStats) Outcomes() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	outcomes := make(map[string]string, len(s.outcomes))
+	for currency, recorded := range s.outcomes {
+		outcomes[currency] = recorded[len(recorded)-1]
+	}
+	return outcomes
+}
+
+// Counts returns the number of times each outcome was recorded.
+func (s *RunStats) Counts() map[string]int {
+	counts := make(map[string]int, len(runOutcomes))
+	for _, outcome := range runOutcomes {
+		counts[outcome] = s.Count(outcome)
+	}
+	return counts
+}
+
+// AllSkipped reports whether every recorded outcome, other than the known unsupported
+// currencies, is a skip because the currency's record was already current, i.e. the run found
+// nothing to do.
+func (s *RunStats) AllSkipped() bool {
+	skipped := s.Count(outcomeSkipped)
+	if skipped == 0 {
+		return false
+	}
+	total := 0
+	for _, outcome := range runOutcomes {
+		if outcome != outcomeUnsupported {
+			total += s.Count(outcome)
+		}
+	}
+	return total == skipped
+}
+
+// CurrenciesWithOutcome lists, sorted, the currencies whose latest outcome is outcome.
+func (s *RunStats) CurrenciesWithOutcome(outcome string) []string {
+	var currencies []string
+	for currency, latest := range s.Outcomes() {
+		if latest == outcome {
+			currencies = append(currencies, currency)
+		}
+	}
+	sort.Strings(currencies)
+	return currencies
+}
+
+// Completeness returns the percentage of currencies, excluding the ones in excluded, that have
+// fresh data for the run's date: stored by this run or already present and not degraded, which
+// is what a skipped outcome means. Degraded carry-forwards do not count as fresh. With no
+// currencies left to count it is 100.
+func (s *RunStats) Completeness(currencies []string, excluded map[string]bool) float64 {
+	outcomes := s.Outcomes()
+	total, fresh := 0, 0
+	for _, currency := range currencies {
+		if excluded[currency] {
+			continue
+		}
+		total++
+		if outcome := outcomes[currency]; outcome == outcomeSuccess || outcome == outcomeSkipped {
+			fresh++
+		}
+	}
+	if total == 0 {
+		return 100
+	}
+	return math.Round(float64(fresh)*1000/float64(total)) / 10
+}
+
+// Fields returns the counts as log fields for the run summary.
+func (s *RunStats) Fields() logrus.Fields {
+	return logrus.Fields{
+		"success_count":  s.Count(outcomeSuccess),
+		"error_count":    s.Count(outcomeError),
+		"skipped_count":  s.Count(outcomeSkipped),
+		"dead_lettered":  s.Count(outcomeDeadLettered),
+		"degraded_count": s.Count(outcomeDegraded),
+		"skipped_budget": s.Count(outcomeSkippedBudget),
+		"unsupported":    s.Count(outcomeUnsupported),
+		"failed":         s.CurrenciesWithOutcome(outcomeError),
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestRunStatsConcurrentRecord(t *testing.T) {
+	const workers = 8
+	const perWorker = 50
+
+	stats := NewRunStats()
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				currency := fmt.Sprintf("W%dC%d", w, i)
+				stats.Record(context.Background(), currency, runOutcomes[i%len(runOutcomes)])
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	want := make(map[string]int, len(runOutcomes))
+	for i := 0; i < perWorker; i++ {
+		want[runOutcomes[i%len(runOutcomes)]] += workers
+	}
+	for _, outcome := range runOutcomes {
+		if got := stats.Count(outcome); got != want[outcome] {
+			t.Errorf("Count(%q) = %d, want %d", outcome, got, want[outcome])
+		}
+	}
+
+	outcomes := stats.Outcomes()
+	if len(outcomes) != workers*perWorker {
+		t.Fatalf("Outcomes() has %d currencies, want %d", len(outcomes), workers*perWorker)
+	}
+	for w := 0; w < workers; w++ {
+		for i := 0; i < perWorker; i++ {
+			currency := fmt.Sprintf("W%dC%d", w, i)
+			if got, want := outcomes[currency], runOutcomes[i%len(runOutcomes)]; got != want {
+				t.Errorf("Outcomes()[%q] = %q, want %q", currency, got, want)
+			}
+		}
+	}
+}
+
+func TestRunStatsLatestOutcomeWins(t *testing.T) {
+	stats := NewRunStats()
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				stats.Record(context.Background(), "EUR", outcomeError)
+			}
+		}()
+	}
+	wg.Wait()
+	stats.Record(context.Background(), "EUR", outcomeSuccess)
+
+	if got := stats.Count(outcomeError); got != 400 {
+		t.Errorf("Count(error) = %d, want 400", got)
+	}
+	if got := stats.Outcomes()["EUR"]; got != outcomeSuccess {
+		t.Errorf("Outcomes()[EUR] = %q, want %q", got, outcomeSuccess)
+	}
+}
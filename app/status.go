@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/sirupsen/logrus"
+)
+
+const runStatusKey = "RunStatus"
+
+// Overall outcome of a cooker run
+const (
+	runOutcomeSuccess = "success"
+	runOutcomePartial = "partial"
+	runOutcomeFailed  = "failed"
+)
+
+// RunStatusRecord describes the most recent cooker run. It is overwritten by every run, except
+// LastSuccessAt which only moves forward on successful runs.
+type RunStatusRecord struct {
+	Key              string         `dynamodbav:"Key"`
+	SortKey          string         `dynamodbav:"SortKey"`
+	RunDate          string         `dynamodbav:"RunDate"`
+	StartedAt        time.Time      `dynamodbav:"StartedAt"`
+	CompletedAt      time.Time      `dynamodbav:"CompletedAt"`
+	Outcome          string         `dynamodbav:"Outcome"`
+	Counts           map[string]int `dynamodbav:"Counts"`
+	LastSuccessAt    time.Time      `dynamodbav:"LastSuccessAt,omitempty"`
+	SchemaVersion    int            `dynamodbav:"SchemaVersion"`
+	WrittenByVersion string         `dynamodbav:"WrittenByVersion,omitempty"`
+
+	// ErrorDigest groups the run's errors, only stored when ERROR_DIGEST_STORE is enabled
+	ErrorDigest []ErrorDigestEntry `dynamodbav:"ErrorDigest,omitempty"`
+}
+
+type StatusResponse struct {
+	LastRunAt      time.Time  `json:"last_run_at"`
+	LastRunOutcome string     `json:"last_run_outcome"`
+	LastSuccessAt  *time.Time `json:"last_success_at,omitempty"`
+	Date           string     `json:"date"`
+	Complete       bool       `json:"complete"`
+	Missing        []string   `json:"missing,omitempty"`
+}
+
+// runOutcome summarizes the per-currency outcomes: failed when nothing succeeded or was
+// skipped, partial when some currencies errored.
+func runOutcome(stats *RunStats) string {
+	errorCount := stats.Count(outcomeError)
+	switch {
+	case errorCount > 0 && stats.Count(outcomeSuccess) == 0 && stats.Count(outcomeSkipped) == 0:
+		return runOutcomeFailed
+	case errorCount > 0:
+		return runOutcomePartial
+	default:
+		return runOutcomeSuccess
+	}
+}
+
+// storeRunStatus records the outcome of the run for the status endpoint. The error digest is
+// included when ERROR_DIGEST_STORE is enabled, and a digest of an earlier run is removed.
+func storeRunStatus(ctx context.Context, date string, startedAt time.Time, stats *RunStats, errorDigest []ErrorDigestEntry) error {
+	keyItem, err := attributevalue.MarshalMap(map[string]interface{}{
+		"Key":     prefixedKey(runStatusKey),
+		"SortKey": "-",
+	})
+	if err != nil {
+		return fmt.Errorf("error marshaling run status key: %w", err)
+	}
+
+	now := time.Now()
+	outcome := runOutcome(stats)
+	attributes := map[string]interface{}{
+		":runDate":          date,
+		":startedAt":        startedAt,
+		":completedAt":      now,
+		":outcome":          outcome,
+		":counts":           stats.Counts(),
+		":schemaVersion":    runStatusSchemaVersion,
+		":writtenByVersion": buildVersion,
+	}
+
+	update := "SET RunDate = :runDate, StartedAt = :startedAt, CompletedAt = :completedAt, Outcome = :outcome, " +
+		"Counts = :counts, SchemaVersion = :schemaVersion, WrittenByVersion = :writtenByVersion"
+	if outcome == runOutcomeSuccess {
+		update += ", LastSuccessAt = :completedAt"
+	}
+	if errorDigestStore && len(errorDigest) > 0 {
+		attributes[":errorDigest"] = errorDigest
+		update += ", ErrorDigest = :errorDigest"
+	} else {
+		update += " REMOVE ErrorDigest"
+	}
+
+	values, err := attributevalue.MarshalMap(attributes)
+	if err != nil {
+		return fmt.Errorf("error marshaling run status: %w", err)
+	}
+
+	_, err = dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(tableName),
+		Key:                       keyItem,
+		UpdateExpression:          aws.String(update),
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		return fmt.Errorf("error storing run status: %w", err)
+	}
+
+	logrus.WithField("outcome", outcome).Debug("Run status stored")
+	return nil
+}
+
+func getRunStatus(ctx context.Context) (*RunStatusRecord, error) {
+	keyItem, err := attributevalue.MarshalMap(map[string]interface{}{
+		"Key":     prefixedKey(runStatusKey),
+		"SortKey": "-",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling run status key: %w", err)
+	}
+
+	result, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(tableName),
+		Key:       keyItem,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading run status: %w", err)
+	}
+
+	if result.Item == nil {
+		return nil, nil
+	}
+
+	var record RunStatusRecord
+	if err := attributevalue.UnmarshalMap(result.Item, &record); err != nil {
+		return nil, fmt.Errorf("error unmarshaling run status record: %w", err)
+	}
+	record.Key = unprefixedKey(record.Key)
+
+	return &record, nil
+}
+
+// handleGetStatus reports the most recent run and whether today's rates are stored for every
+// supported currency, as a single health probe for uptime checks.
+func handleGetStatus(ctx context.Context, logger *logrus.Entry) events.APIGatewayV2HTTPResponse {
+	record, err := getRunStatus(ctx)
+	if err != nil {
+		logger.WithError(err).Error("Failed to read run status")
+		return errorResponse(http.StatusInternalServerError, "failed to read run status")
+	}
+	if record == nil {
+		return errorResponse(http.StatusNotFound, "no run recorded yet")
+	}
+
+	date := todayDate()
+	missing, err := findMissingCurrencies(ctx, date)
+	if err != nil {
+		logger.WithError(err).Error("Failed to check today's completeness")
+		return errorResponse(http.StatusInternalServerError, "failed to check today's completeness")
+	}
+
+	response := StatusResponse{
+		LastRunAt:      record.CompletedAt,
+		LastRunOutcome: record.Outcome,
+		Date:           date,
+		Complete:       len(missing) == 0,
+		Missing:        missing,
+	}
+	if !record.LastSuccessAt.IsZero() {
+		response.LastSuccessAt = &record.LastSuccessAt
+	}
+	return jsonResponse(http.StatusOK, response)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "ahorro-exchange-rate-cooker"
+
+var (
+	tracerProvider *sdktrace.TracerProvider
+	meterProvider  *sdkmetric.MeterProvider
+
+	// Instruments resolve to no-ops until setupTelemetry installs real providers
+	tracer              trace.Tracer
+	currencyOutcomes    metric.Int64Counter
+	fetchDuration       metric.Float64Histogram
+	dynamoOpDuration    metric.Float64Histogram
+	runDuration         metric.Float64Histogram
+	telemetryConfigured bool
+)
+
+// setupTelemetry installs OTLP trace and metric exporters when OTEL_ENABLED is set. The exporters
+// read the standard OTEL_EXPORTER_OTLP_* variables and the resource honors OTEL_SERVICE_NAME and
+// OTEL_RESOURCE_ATTRIBUTES. When disabled the global no-op providers stay in place.
+func setupTelemetry(ctx context.Context) {
+	if otelEnabled {
+		if err := installTelemetryProviders(ctx); err != nil {
+			logrus.WithError(err).Error("Failed to set up OpenTelemetry, continuing without it")
+		} else {
+			telemetryConfigured = true
+		}
+	}
+
+	tracer = otel.Tracer(instrumentationName)
+	meter := otel.Meter(instrumentationName)
+
+	var err error
+	if currencyOutcomes, err = meter.Int64Counter("exchange_rate_cooker.currency.outcomes",
+		metric.WithDescription("Per-currency run outcomes")); err != nil {
+		logrus.WithError(err).Error("Failed to create outcomes counter")
+	}
+	if fetchDuration, err = meter.Float64Histogram("exchange_rate_cooker.fetch.duration",
+		metric.WithDescription("Provider fetch latency"), metric.WithUnit("ms")); err != nil {
+		logrus.WithError(err).Error("Failed to create fetch duration histogram")
+	}
+	if dynamoOpDuration, err = meter.Float64Histogram("exchange_rate_cooker.dynamodb.duration",
+		metric.WithDescription("DynamoDB operation latency"), metric.WithUnit("ms")); err != nil {
+		logrus.WithError(err).Error("Failed to create DynamoDB duration histogram")
+	}
+	if runDuration, err = meter.Float64Histogram("exchange_rate_cooker.run.duration",
+		metric.WithDescription("Whole run duration"), metric.WithUnit("ms")); err != nil {
+		logrus.WithError(err).Error("Failed to create run duration histogram")
+	}
+
+	logrus.WithField("otel_enabled", telemetryConfigured).Info("Telemetry configured")
+}
+
+func installTelemetryProviders(ctx context.Context) error {
+	res, err := resource.Merge(resource.Default(), resource.Environment())
+	if err != nil {
+		return err
+	}
+
+	traceExporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return err
+	}
+	metricExporter, err := otlpmetrichttp.New(ctx)
+	if err != nil {
+		return err
+	}
+
+	tracerProvider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(traceExporter),
+		sdktrace.WithResource(res),
+	)
+	meterProvider = sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter)),
+		sdkmetric.WithResource(res),
+	)
+
+	otel.SetTracerProvider(tracerProvider)
+	otel.SetMeterProvider(meterProvider)
+	return nil
+}
+
+// flushTelemetry exports buffered spans and metrics. Lambda freezes the container between
+// invocations, so this must run before the handler returns.
+func flushTelemetry(ctx context.Context) {
+	if !telemetryConfigured {
+		return
+	}
+
+	if err := tracerProvider.ForceFlush(ctx); err != nil {
+		logrus.WithError(err).Warn("Failed to flush traces")
+	}
+	if err := meterProvider.ForceFlush(ctx); err != nil {
+		logrus.WithError(err).Warn("Failed to flush metrics")
+	}
+}
+
+// startSpan starts a span for the operation and returns a function that ends it, recording
+// err on the span and the elapsed time on the histogram. The error is redacted before export,
+// since provider transport errors carry the request URL with the API key in it.
+func startSpan(ctx context.Context, name string, histogram metric.Float64Histogram, attrs ...attribute.KeyValue) (context.Context, func(err error)) {
+	start := time.Now()
+	ctx, span := tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+
+	return ctx, func(err error) {
+		if err != nil {
+			redacted := errors.New(redactSecrets(err.Error()))
+			span.RecordError(redacted)
+			span.SetStatus(codes.Error, redacted.Error())
+		}
+		span.End()
+
+		if histogram != nil {
+			elapsed := float64(time.Since(start).Microseconds()) / 1000
+			histogram.Record(ctx, elapsed, metric.WithAttributes(append(attrs, attribute.Bool("error", err != nil))...))
+		}
+	}
+}
+
+func recordCurrencyOutcome(ctx context.Context, baseCurrency, outcome string) {
+	if currencyOutcomes == nil {
+		return
+	}
+	currencyOutcomes.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("currency", baseCurrency),
+		attribute.String("outcome", outcome),
+	))
+}
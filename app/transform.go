@@ -0,0 +1,339 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	selfRateInclude = "include"
+	selfRateExclude = "exclude"
+)
+
+// Policies for rates outside RATE_BOUNDS
+const (
+	rateBoundsDrop = "drop"
+	rateBoundsFlag = "flag"
+	rateBoundsSkip = "skip"
+)
+
+// Rounding modes for ROUND_MODE
+const (
+	roundHalfUp   = "half-up"
+	roundHalfEven = "half-even"
+	roundDown     = "down"
+	roundUp       = "up"
+)
+
+// RateBounds is the plausible range of a pair's rate. A zero Min or Max leaves that side open.
+type RateBounds struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+// loadRateBounds parses RATE_BOUNDS, a JSON object of BASE/TARGET pairs to bounds, e.g.
+// {"USD/UAH": {"min": 20, "max": 80}}.
+func loadRateBounds(boundsJSON string) (map[CurrencyPair]RateBounds, error) {
+	bounds := make(map[CurrencyPair]RateBounds)
+	if boundsJSON == "" {
+		return bounds, nil
+	}
+
+	var entries map[string]RateBounds
+	if err := json.Unmarshal([]byte(boundsJSON), &entries); err != nil {
+		return nil, fmt.Errorf("RATE_BOUNDS must be a JSON object of pairs to min/max bounds: %w", err)
+	}
+	for key, bound := range entries {
+		base, target, ok := strings.Cut(strings.ToUpper(key), "/")
+		if !ok || !isCurrencyCode(base) || !isCurrencyCode(target) || base == target {
+			return nil, fmt.Errorf("RATE_BOUNDS key %q must be distinct BASE/TARGET currency codes", key)
+		}
+		if bound.Min < 0 || bound.Max < 0 || (bound.Min == 0 && bound.Max == 0) || (bound.Max > 0 && bound.Min > bound.Max) {
+			return nil, fmt.Errorf("RATE_BOUNDS entry %s needs a non-negative min and max with min <= max, got %v and %v", key, bound.Min, bound.Max)
+		}
+		bounds[CurrencyPair{Base: base, Target: target}] = bound
+	}
+	return bounds, nil
+}
+
+// checkRateBounds applies RATE_BOUNDS to the targets of baseCurrency. Under the "drop" policy
+// out-of-range targets are removed, "flag" stores the response marked Suspect and "skip" rejects
+// it like a failed fetch.
+func checkRateBounds(logger *logrus.Entry, baseCurrency string, rates *ExchangeRateResponse) error {
+	var violations []string
+	for pair, bound := range rateBounds {
+		if pair.Base != baseCurrency {
+			continue
+		}
+		rate, ok := rates.ConversionRates[pair.Target]
+		if !ok || bound.contains(rate) {
+			continue
+		}
+
+		logger.WithFields(logrus.Fields{
+			"target": pair.Target,
+			"rate":   rate,
+			"min":    bound.Min,
+			"max":    bound.Max,
+			"policy": rateBoundsPolicy,
+		}).Warn("Rate outside of configured plausibility bounds")
+		violations = append(violations, pair.Target)
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+	sort.Strings(violations)
+
+	switch rateBoundsPolicy {
+	case rateBoundsSkip:
+		return fmt.Errorf("implausible rates for targets %v", violations)
+	case rateBoundsFlag:
+		rates.Suspect = true
+	default:
+		for _, target := range violations {
+			delete(rates.ConversionRates, target)
+			delete(rates.BidRates, target)
+			delete(rates.AskRates, target)
+		}
+	}
+	return nil
+}
+
+func (b RateBounds) contains(rate float64) bool {
+	return rate >= b.Min && (b.Max == 0 || rate <= b.Max)
+}
+
+// normalizeSelfRate makes the base->base entry consistent across providers: with SELF_RATE_MODE
+// include it is always present and exactly 1.0, with exclude it is always absent.
+func normalizeSelfRate(logger *logrus.Entry, baseCurrency string, rates *ExchangeRateResponse) {
+	rate, present := rates.ConversionRates[baseCurrency]
+
+	if selfRateMode == selfRateExclude {
+		if !present {
+			return
+		}
+		delete(rates.ConversionRates, baseCurrency)
+		delete(rates.BidRates, baseCurrency)
+		delete(rates.AskRates, baseCurrency)
+		logger.WithField("provider_rate", rate).Debug("Removed self rate from exchange rates")
+		return
+	}
+
+	if present && rate == 1.0 {
+		return
+	}
+	rates.ConversionRates[baseCurrency] = 1.0
+	if present {
+		logger.WithField("provider_rate", rate).Warn("Provider self rate was not 1.0, replaced it")
+	} else {
+		logger.Debug("Added missing self rate to exchange rates")
+	}
+}
+
+// filterPeggedRates drops targets that carry no information for the base: rates of exactly 1.0
+// (other than the base itself) and targets listed in PEGGED_CURRENCIES. It is a no-op unless
+// FILTER_PEGGED_RATES is enabled.
+func filterPeggedRates(logger *logrus.Entry, baseCurrency string, rates *ExchangeRateResponse) {
+	if !filterPegged {
+		return
+	}
+
+	var dropped []string
+	for target, rate := range rates.ConversionRates {
+		if target == baseCurrency {
+			continue
+		}
+		if rate == 1.0 || peggedCurrencies[target] {
+			dropped = append(dropped, target)
+		}
+	}
+
+	if len(dropped) == 0 {
+		return
+	}
+
+	for _, target := range dropped {
+		delete(rates.ConversionRates, target)
+		delete(rates.BidRates, target)
+		delete(rates.AskRates, target)
+	}
+
+	sort.Strings(dropped)
+	logger.WithFields(logrus.Fields{
+		"dropped_targets": dropped,
+		"dropped_count":   len(dropped),
+	}).Info("Dropped pegged targets from exchange rates")
+}
+
+// loadCurrencyCodeRemap parses CURRENCY_CODE_REMAP, a JSON object mapping provider codes to the
+// canonical codes to store them under, e.g. {"CNH": "CNY"}.
+func loadCurrencyCodeRemap(remapJSON string) (map[string]string, error) {
+	remap := make(map[string]string)
+	if remapJSON == "" {
+		return remap, nil
+	}
+
+	if err := json.Unmarshal([]byte(remapJSON), &remap); err != nil {
+		return nil, fmt.Errorf("CURRENCY_CODE_REMAP must be a JSON object of currency codes: %w", err)
+	}
+	for from, to := range remap {
+		if !isCurrencyCode(from) || !isCurrencyCode(to) || from == to {
+			return nil, fmt.Errorf("CURRENCY_CODE_REMAP entry %q must map to a different currency code, got %q", from, to)
+		}
+		// Chained remaps would depend on the order they are applied in
+		if _, chained := remap[to]; chained {
+			return nil, fmt.Errorf("CURRENCY_CODE_REMAP entry %q maps to %s, which is remapped itself", from, to)
+		}
+	}
+	return remap, nil
+}
+
+// remapCurrencyCodes rewrites provider codes to their canonical codes from CURRENCY_CODE_REMAP.
+// When the provider also sent the canonical code, its own rate wins and the remapped one is
+// dropped. Codes are remapped in sorted order, so when several codes map to the same canonical
+// code the first of them wins.
+func remapCurrencyCodes(logger *logrus.Entry, rates *ExchangeRateResponse) {
+	if len(currencyCodeRemap) == 0 {
+		return
+	}
+
+	sources := make([]string, 0, len(currencyCodeRemap))
+	for from := range currencyCodeRemap {
+		sources = append(sources, from)
+	}
+	sort.Strings(sources)
+
+	if canonical, ok := currencyCodeRemap[rates.BaseCode]; ok {
+		logger.WithFields(logrus.Fields{"from": rates.BaseCode, "to": canonical}).Info("Remapped provider base code")
+		rates.BaseCode = canonical
+	}
+
+	for _, ratesMap := range []ProviderRates{rates.ConversionRates, rates.BidRates, rates.AskRates} {
+		for _, from := range sources {
+			to := currencyCodeRemap[from]
+			rate, ok := ratesMap[from]
+			if !ok {
+				continue
+			}
+			delete(ratesMap, from)
+
+			if _, exists := ratesMap[to]; exists {
+				logger.WithFields(logrus.Fields{"from": from, "to": to}).Warn("Provider sent both codes, keeping the canonical rate")
+				continue
+			}
+			ratesMap[to] = rate
+			logger.WithFields(logrus.Fields{"from": from, "to": to}).Info("Remapped provider currency code")
+		}
+	}
+}
+
+// roundRates rounds every rate with roundRate. It is a no-op unless ROUND_DECIMALS is set.
+func roundRates(rates *ExchangeRateResponse) {
+	if roundDecimals < 0 {
+		return
+	}
+	for _, ratesMap := range []ProviderRates{rates.ConversionRates, rates.BidRates, rates.AskRates} {
+		for target, rate := range ratesMap {
+			ratesMap[target] = roundRate(target, rate)
+		}
+	}
+}
+
+// roundRate rounds the rate of target to ROUND_DECIMALS places using ROUND_MODE, but never to
+// fewer than the target's significant digits, so tiny rates such as VND in USD are not cut to
+// one or two digits by a fixed number of decimals.
+func roundRate(target string, rate float64) float64 {
+	decimals := roundDecimals
+	if digits, ok := roundSignificantByCurrency[target]; ok || roundSignificantDigits > 0 {
+		if !ok {
+			digits = roundSignificantDigits
+		}
+		if needed := significantDecimals(rate, digits); needed > decimals {
+			decimals = needed
+		}
+	}
+	return roundDecimal(rate, decimals, roundMode)
+}
+
+// significantDecimals returns how many decimal places keep digits significant digits of value.
+func significantDecimals(value float64, digits int) int {
+	if value == 0 || digits <= 0 {
+		return 0
+	}
+	// The exponent of the shortest scientific form is the position of the leading digit
+	formatted := strconv.FormatFloat(value, 'e', -1, 64)
+	exponent, err := strconv.Atoi(formatted[strings.IndexByte(formatted, 'e')+1:])
+	if err != nil {
+		return 0
+	}
+	return digits - 1 - exponent
+}
+
+// loadRoundSignificantByCurrency parses ROUND_SIGNIFICANT_DIGITS_BY_CURRENCY, a JSON object of
+// target currency codes to significant digits, e.g. {"VND": 8}.
+func loadRoundSignificantByCurrency(digitsJSON string) (map[string]int, error) {
+	digits := make(map[string]int)
+	if digitsJSON == "" {
+		return digits, nil
+	}
+
+	if err := json.Unmarshal([]byte(digitsJSON), &digits); err != nil {
+		return nil, fmt.Errorf("ROUND_SIGNIFICANT_DIGITS_BY_CURRENCY must be a JSON object of currency codes to digits: %w", err)
+	}
+	for currency, value := range digits {
+		if !isCurrencyCode(currency) || value < 1 || value > 17 {
+			return nil, fmt.Errorf("ROUND_SIGNIFICANT_DIGITS_BY_CURRENCY entry %q must map a currency code to 1-17 digits, got %d", currency, value)
+		}
+	}
+	return digits, nil
+}
+
+// roundDecimal rounds value to decimals places. It works on the shortest decimal form of the
+// float, so a rate the provider sent as 1.2345 rounds as exactly 1.2345 rather than as its
+// binary approximation. Ties are resolved by mode; down and up round towards and away from zero.
+func roundDecimal(value float64, decimals int, mode string) float64 {
+	exact, ok := new(big.Rat).SetString(strconv.FormatFloat(value, 'g', -1, 64))
+	if !ok {
+		return value
+	}
+
+	scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil))
+	scaled := new(big.Rat).Mul(exact, scale)
+
+	// Split |scaled| into its integer part and the remaining fraction
+	negative := scaled.Sign() < 0
+	scaled.Abs(scaled)
+	quotient, remainder := new(big.Int).QuoRem(scaled.Num(), scaled.Denom(), new(big.Int))
+
+	if remainder.Sign() != 0 {
+		// Compare the fraction with one half: twice the remainder against the denominator
+		half := new(big.Int).Lsh(remainder, 1).Cmp(scaled.Denom())
+		var roundAway bool
+		switch mode {
+		case roundUp:
+			roundAway = true
+		case roundDown:
+			roundAway = false
+		case roundHalfUp:
+			roundAway = half >= 0
+		default:
+			roundAway = half > 0 || (half == 0 && quotient.Bit(0) == 1)
+		}
+		if roundAway {
+			quotient.Add(quotient, big.NewInt(1))
+		}
+	}
+
+	if negative {
+		quotient.Neg(quotient)
+	}
+	rounded, _ := new(big.Rat).SetFrac(quotient, scale.Num()).Float64()
+	return rounded
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestLoadCurrencyCodeRemap(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"unset", "", map[string]string{}, false},
+		{"single remap", `{"CNH": "CNY"}`, map[string]string{"CNH": "CNY"}, false},
+		{"several remaps", `{"CNH": "CNY", "RUR": "RUB"}`, map[string]string{"CNH": "CNY", "RUR": "RUB"}, false},
+		{"not an object", `["CNH"]`, nil, true},
+		{"remap to itself", `{"CNY": "CNY"}`, nil, true},
+		{"not a currency code", `{"CNH": "yuan"}`, nil, true},
+		{"chained remap", `{"AAA": "BBB", "BBB": "CCC"}`, nil, true},
+		{"swapped codes", `{"AAA": "BBB", "BBB": "AAA"}`, nil, true},
+		{"several codes to one", `{"CNH": "CNY", "CNT": "CNY"}`, map[string]string{"CNH": "CNY", "CNT": "CNY"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := loadCurrencyCodeRemap(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadCurrencyCodeRemap(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("loadCurrencyCodeRemap(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemapCurrencyCodes(t *testing.T) {
+	previous := currencyCodeRemap
+	t.Cleanup(func() { currencyCodeRemap = previous })
+	currencyCodeRemap = map[string]string{"CNH": "CNY", "CNT": "CNY", "RUR": "RUB"}
+
+	tests := []struct {
+		name  string
+		rates ExchangeRateResponse
+		want  ExchangeRateResponse
+	}{
+		{
+			name:  "no quirky codes",
+			rates: ExchangeRateResponse{BaseCode: "USD", ConversionRates: ProviderRates{"EUR": 0.9}},
+			want:  ExchangeRateResponse{BaseCode: "USD", ConversionRates: ProviderRates{"EUR": 0.9}},
+		},
+		{
+			name:  "target code remapped",
+			rates: ExchangeRateResponse{BaseCode: "USD", ConversionRates: ProviderRates{"EUR": 0.9, "CNH": 7.2}},
+			want:  ExchangeRateResponse{BaseCode: "USD", ConversionRates: ProviderRates{"EUR": 0.9, "CNY": 7.2}},
+		},
+		{
+			name:  "base code remapped",
+			rates: ExchangeRateResponse{BaseCode: "CNH", ConversionRates: ProviderRates{"USD": 0.14}},
+			want:  ExchangeRateResponse{BaseCode: "CNY", ConversionRates: ProviderRates{"USD": 0.14}},
+		},
+		{
+			name:  "canonical rate wins over the remapped one",
+			rates: ExchangeRateResponse{BaseCode: "USD", ConversionRates: ProviderRates{"CNH": 7.3, "CNY": 7.2}},
+			want:  ExchangeRateResponse{BaseCode: "USD", ConversionRates: ProviderRates{"CNY": 7.2}},
+		},
+		{
+			name:  "first of several codes for one canonical code wins",
+			rates: ExchangeRateResponse{BaseCode: "USD", ConversionRates: ProviderRates{"CNT": 7.1, "CNH": 7.3}},
+			want:  ExchangeRateResponse{BaseCode: "USD", ConversionRates: ProviderRates{"CNY": 7.3}},
+		},
+		{
+			name: "bid and ask maps remapped",
+			rates: ExchangeRateResponse{
+				BaseCode:        "USD",
+				ConversionRates: ProviderRates{"RUR": 90},
+				BidRates:        ProviderRates{"RUR": 89.5},
+				AskRates:        ProviderRates{"RUR": 90.5},
+			},
+			want: ExchangeRateResponse{
+				BaseCode:        "USD",
+				ConversionRates: ProviderRates{"RUB": 90},
+				BidRates:        ProviderRates{"RUB": 89.5},
+				AskRates:        ProviderRates{"RUB": 90.5},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rates := tt.rates
+			remapCurrencyCodes(logrus.NewEntry(logrus.StandardLogger()), &rates)
+			if !reflect.DeepEqual(rates, tt.want) {
+				t.Errorf("remapCurrencyCodes() = %+v, want %+v", rates, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoundDecimal(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    float64
+		decimals int
+		mode     string
+		want     float64
+	}{
+		{"half-up tie", 1.25, 1, roundHalfUp, 1.3},
+		{"half-up tie odd", 1.35, 1, roundHalfUp, 1.4},
+		{"half-up below tie", 1.249, 1, roundHalfUp, 1.2},
+		{"half-up negative tie", -1.25, 1, roundHalfUp, -1.3},
+		{"half-up integer tie", 2.5, 0, roundHalfUp, 3},
+
+		{"half-even tie to even", 1.25, 1, roundHalfEven, 1.2},
+		{"half-even tie to odd neighbour", 1.35, 1, roundHalfEven, 1.4},
+		{"half-even above tie", 1.251, 1, roundHalfEven, 1.3},
+		{"half-even negative tie", -1.25, 1, roundHalfEven, -1.2},
+		{"half-even integer tie", 2.5, 0, roundHalfEven, 2},
+		{"half-even integer tie odd", 3.5, 0, roundHalfEven, 4},
+
+		{"down tie", 1.25, 1, roundDown, 1.2},
+		{"down near next", 1.29, 1, roundDown, 1.2},
+		{"down negative tie", -1.25, 1, roundDown, -1.2},
+		{"down negative", -1.29, 1, roundDown, -1.2},
+
+		{"up tie", 1.25, 1, roundUp, 1.3},
+		{"up just above", 1.21, 1, roundUp, 1.3},
+		{"up negative tie", -1.25, 1, roundUp, -1.3},
+		{"up negative", -1.21, 1, roundUp, -1.3},
+
+		{"exact value unchanged", 1.2, 1, roundUp, 1.2},
+		{"binary inexact tie", 0.145, 2, roundHalfUp, 0.15},
+		{"unknown mode is half-even", 0.125, 2, "", 0.12},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := roundDecimal(tt.value, tt.decimals, tt.mode); got != tt.want {
+				t.Errorf("roundDecimal(%v, %d, %q) = %v, want %v", tt.value, tt.decimals, tt.mode, got, tt.want)
+			}
+		})
+	}
+}
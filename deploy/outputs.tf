@@ -27,3 +27,8 @@ output "eventbridge_rule_arn" {
   description = "ARN of the EventBridge rule"
   value       = module.exchange_rate_cooker.eventbridge_rule_arn
 }
+
+output "api_endpoint" {
+  description = "Base URL of the read API"
+  value       = module.exchange_rate_cooker.api_endpoint
+}
@@ -1,7 +1,9 @@
 # Local variables
 locals {
-  db_name     = "${var.base_name}-db"
-  lambda_name = "${var.base_name}-lambda"
+  db_name         = "${var.base_name}-db"
+  lambda_name     = "${var.base_name}-lambda"
+  api_lambda_name = "${var.base_name}-api-lambda"
+  api_name        = "${var.base_name}-api"
 }
 
 # Data source to get the Lambda zip from S3
@@ -52,6 +54,13 @@ resource "aws_lambda_function" "exchange_rate_cooker" {
       EXCHANGE_RATE_API_KEY = var.exchange_rate_api_key
       SUPPORTED_CURRENCIES  = join("|", var.supported_currencies)
       TTL_INTERVAL_DAYS     = var.ttl_interval_days
+      DEAD_LETTER_THRESHOLD = var.dead_letter_threshold
+      DEAD_LETTER_SKIP      = var.dead_letter_skip
+      REPORT_BUCKET         = var.report_bucket_name
+      REPORT_FORMAT         = var.report_format
+      FAILURE_QUEUE_URL     = var.failure_queue_name == "" ? "" : data.aws_sqs_queue.failure_queue[0].url
+      CONFIG_S3_URI         = var.config_s3_uri
+      METRICS_MODE          = var.metrics_mode
     }
   }
 
@@ -67,6 +76,130 @@ resource "aws_cloudwatch_log_group" "lambda_logs" {
   retention_in_days = 14
 }
 
+# Lambda function serving the read API (same binary, API handler mode)
+resource "aws_lambda_function" "exchange_rate_api" {
+  function_name     = local.api_lambda_name
+  role              = aws_iam_role.api_lambda_role.arn
+  handler           = "bootstrap"
+  runtime           = "provided.al2"
+  s3_bucket         = var.app_s3_bucket_name
+  s3_key            = var.app_s3_artifact_zip_key
+  s3_object_version = data.aws_s3_object.lambda_zip.version_id
+  source_code_hash  = data.aws_s3_object.lambda_zip.etag
+  timeout           = 30
+
+  environment {
+    variables = {
+      HANDLER_MODE          = "api"
+      EXCHANGE_RATE_DB_NAME = aws_dynamodb_table.exchange_rate_db.name
+      SUPPORTED_CURRENCIES  = join("|", var.supported_currencies)
+      CONFIG_S3_URI         = var.config_s3_uri
+    }
+  }
+
+  depends_on = [
+    aws_iam_role_policy_attachment.api_lambda_logs,
+    aws_cloudwatch_log_group.api_lambda_logs,
+  ]
+}
+
+resource "aws_cloudwatch_log_group" "api_lambda_logs" {
+  name              = "/aws/lambda/${local.api_lambda_name}"
+  retention_in_days = 14
+}
+
+# HTTP API for read access to stored data
+resource "aws_apigatewayv2_api" "exchange_rate_api" {
+  name          = local.api_name
+  protocol_type = "HTTP"
+}
+
+resource "aws_apigatewayv2_integration" "exchange_rate_api" {
+  api_id                 = aws_apigatewayv2_api.exchange_rate_api.id
+  integration_type       = "AWS_PROXY"
+  integration_uri        = aws_lambda_function.exchange_rate_api.invoke_arn
+  payload_format_version = "2.0"
+}
+
+resource "aws_apigatewayv2_route" "get_currencies" {
+  api_id    = aws_apigatewayv2_api.exchange_rate_api.id
+  route_key = "GET /currencies"
+  target    = "integrations/${aws_apigatewayv2_integration.exchange_rate_api.id}"
+}
+
+resource "aws_apigatewayv2_route" "get_status" {
+  api_id    = aws_apigatewayv2_api.exchange_rate_api.id
+  route_key = "GET /status"
+  target    = "integrations/${aws_apigatewayv2_integration.exchange_rate_api.id}"
+}
+
+resource "aws_apigatewayv2_stage" "default" {
+  api_id      = aws_apigatewayv2_api.exchange_rate_api.id
+  name        = "$default"
+  auto_deploy = true
+}
+
+resource "aws_lambda_permission" "allow_api_gateway" {
+  statement_id  = "AllowExecutionFromAPIGateway"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.exchange_rate_api.function_name
+  principal     = "apigateway.amazonaws.com"
+  source_arn    = "${aws_apigatewayv2_api.exchange_rate_api.execution_arn}/*/*"
+}
+
+# Metric for currencies moved to dead-letter after repeated failures
+resource "aws_cloudwatch_log_metric_filter" "currency_dead_lettered" {
+  name           = "${local.lambda_name}-currency-dead-lettered"
+  log_group_name = aws_cloudwatch_log_group.lambda_logs.name
+  pattern        = "{ $.metric = \"CurrencyDeadLettered\" }"
+
+  metric_transformation {
+    name      = "CurrencyDeadLettered"
+    namespace = "Ahorro/ExchangeRateCooker"
+    value     = "1"
+  }
+}
+
+# Metric for supported currencies still missing a record after the validation sweep
+resource "aws_cloudwatch_log_metric_filter" "currencies_missing" {
+  name           = "${local.lambda_name}-currencies-missing"
+  log_group_name = aws_cloudwatch_log_group.lambda_logs.name
+  pattern        = "{ $.metric = \"CurrenciesMissing\" }"
+
+  metric_transformation {
+    name      = "CurrenciesMissing"
+    namespace = "Ahorro/ExchangeRateCooker"
+    value     = "1"
+  }
+}
+
+# Metric for runs that found every record already current (NOOP_RUN_SIGNAL)
+resource "aws_cloudwatch_log_metric_filter" "no_op_run" {
+  name           = "${local.lambda_name}-no-op-run"
+  log_group_name = aws_cloudwatch_log_group.lambda_logs.name
+  pattern        = "{ $.metric = \"NoOpRun\" }"
+
+  metric_transformation {
+    name      = "NoOpRun"
+    namespace = "Ahorro/ExchangeRateCooker"
+    value     = "1"
+  }
+}
+
+# Share of supported currencies with fresh data after each run, from the run summary line
+resource "aws_cloudwatch_log_metric_filter" "run_completeness" {
+  name           = "${local.lambda_name}-run-completeness"
+  log_group_name = aws_cloudwatch_log_group.lambda_logs.name
+  pattern        = "{ $.completeness_percent >= 0 }"
+
+  metric_transformation {
+    name      = "RunCompleteness"
+    namespace = "Ahorro/ExchangeRateCooker"
+    value     = "$.completeness_percent"
+    unit      = "Percent"
+  }
+}
+
 # IAM role for Lambda
 resource "aws_iam_role" "lambda_role" {
   name = "${local.lambda_name}-role"
@@ -104,6 +237,110 @@ resource "aws_iam_role_policy" "lambda_dynamodb" {
         Action = [
           "dynamodb:PutItem",
           "dynamodb:GetItem",
+          "dynamodb:BatchGetItem",
+          "dynamodb:UpdateItem",
+          "dynamodb:DeleteItem",
+        ]
+        Resource = aws_dynamodb_table.exchange_rate_db.arn
+      }
+    ]
+  })
+}
+
+# Daily rate report uploads, only when a report bucket is configured
+resource "aws_iam_role_policy" "lambda_report" {
+  count = var.report_bucket_name == "" ? 0 : 1
+  name  = "${local.lambda_name}-report-policy"
+  role  = aws_iam_role.lambda_role.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect   = "Allow"
+        Action   = ["s3:PutObject"]
+        Resource = "arn:aws:s3:::${var.report_bucket_name}/*"
+      }
+    ]
+  })
+}
+
+# Metric publishing, only when metrics are sent with PutMetricData
+resource "aws_iam_role_policy" "lambda_metrics" {
+  count = var.metrics_mode == "api" ? 1 : 0
+  name  = "${local.lambda_name}-metrics-policy"
+  role  = aws_iam_role.lambda_role.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect   = "Allow"
+        Action   = ["cloudwatch:PutMetricData"]
+        Resource = "*"
+        Condition = {
+          StringEquals = {
+            "cloudwatch:namespace" = "Ahorro/ExchangeRateCooker"
+          }
+        }
+      }
+    ]
+  })
+}
+
+# Config object reads, only when a config object is configured
+resource "aws_iam_role_policy" "lambda_config" {
+  count = var.config_s3_uri == "" ? 0 : 1
+  name  = "${local.lambda_name}-config-policy"
+  role  = aws_iam_role.lambda_role.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect   = "Allow"
+        Action   = ["s3:GetObject"]
+        Resource = "arn:aws:s3:::${trimprefix(var.config_s3_uri, "s3://")}"
+      }
+    ]
+  })
+}
+
+# IAM role for the read API Lambda, read-only since the API is public and unauthenticated
+resource "aws_iam_role" "api_lambda_role" {
+  name = "${local.api_lambda_name}-role"
+
+  assume_role_policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Action = "sts:AssumeRole"
+        Principal = {
+          Service = "lambda.amazonaws.com"
+        }
+        Effect = "Allow"
+      }
+    ]
+  })
+}
+
+resource "aws_iam_role_policy_attachment" "api_lambda_logs" {
+  role       = aws_iam_role.api_lambda_role.name
+  policy_arn = "arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"
+}
+
+resource "aws_iam_role_policy" "api_lambda_dynamodb" {
+  name = "${local.api_lambda_name}-dynamodb-policy"
+  role = aws_iam_role.api_lambda_role.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "dynamodb:GetItem",
+          "dynamodb:BatchGetItem",
         ]
         Resource = aws_dynamodb_table.exchange_rate_db.arn
       }
@@ -111,6 +348,46 @@ resource "aws_iam_role_policy" "lambda_dynamodb" {
   })
 }
 
+resource "aws_iam_role_policy" "api_lambda_config" {
+  count = var.config_s3_uri == "" ? 0 : 1
+  name  = "${local.api_lambda_name}-config-policy"
+  role  = aws_iam_role.api_lambda_role.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect   = "Allow"
+        Action   = ["s3:GetObject"]
+        Resource = "arn:aws:s3:::${trimprefix(var.config_s3_uri, "s3://")}"
+      }
+    ]
+  })
+}
+
+# Failure queue publishing, only when a failure queue is configured
+data "aws_sqs_queue" "failure_queue" {
+  count = var.failure_queue_name == "" ? 0 : 1
+  name  = var.failure_queue_name
+}
+
+resource "aws_iam_role_policy" "lambda_failure_queue" {
+  count = var.failure_queue_name == "" ? 0 : 1
+  name  = "${local.lambda_name}-failure-queue-policy"
+  role  = aws_iam_role.lambda_role.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect   = "Allow"
+        Action   = ["sqs:SendMessage"]
+        Resource = data.aws_sqs_queue.failure_queue[0].arn
+      }
+    ]
+  })
+}
+
 # EventBridge rule for scheduled execution
 resource "aws_cloudwatch_event_rule" "exchange_rate_schedule" {
   name                = "${local.lambda_name}-schedule"
@@ -27,3 +27,8 @@ output "eventbridge_rule_arn" {
   description = "ARN of the EventBridge rule"
   value       = aws_cloudwatch_event_rule.exchange_rate_schedule.arn
 }
+
+output "api_endpoint" {
+  description = "Base URL of the read API"
+  value       = aws_apigatewayv2_stage.default.invoke_url
+}
@@ -37,3 +37,45 @@ variable "ttl_interval_days" {
   type        = number
   default     = 30
 }
+
+variable "dead_letter_threshold" {
+  description = "Consecutive failures before a currency is dead-lettered (0 disables tracking)"
+  type        = number
+  default     = 0
+}
+
+variable "dead_letter_skip" {
+  description = "Skip dead-lettered currencies until the dead-letter record is deleted"
+  type        = bool
+  default     = false
+}
+
+variable "report_bucket_name" {
+  description = "S3 bucket for the daily rate report (empty disables the report)"
+  type        = string
+  default     = ""
+}
+
+variable "report_format" {
+  description = "Daily rate report format: markdown or html"
+  type        = string
+  default     = "markdown"
+}
+
+variable "failure_queue_name" {
+  description = "Existing SQS queue that receives per-currency failure messages (empty disables publishing)"
+  type        = string
+  default     = ""
+}
+
+variable "config_s3_uri" {
+  description = "s3://bucket/key of a JSON config object merged over the Lambda environment (empty disables it)"
+  type        = string
+  default     = ""
+}
+
+variable "metrics_mode" {
+  description = "CloudWatch metrics: emf log lines, api PutMetricData calls or none"
+  type        = string
+  default     = "none"
+}